@@ -0,0 +1,49 @@
+package common
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
+// ContactHashLength the length of hex encoded SHA-256 contact hash
+const ContactHashLength = 64
+
+// NormalizePhone keep the digits and the leading "+" of phone number
+func NormalizePhone(phone string) string {
+	var sb strings.Builder
+	for i, c := range strings.TrimSpace(phone) {
+		if c >= '0' && c <= '9' || c == '+' && i == 0 {
+			sb.WriteRune(c)
+		}
+	}
+	return sb.String()
+}
+
+// NormalizeEmail trim and lowercase the email address
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// HashContact return the hex encoded SHA-256 of normalized phone or email, "" if it is empty
+/* the clients should hash the contacts in address book in the same way before uploading */
+func HashContact(normalized string) string {
+	if normalized == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
+
+// IsContactHash check if s is a lowercase hex encoded SHA-256
+func IsContactHash(s string) bool {
+	if len(s) != ContactHashLength {
+		return false
+	}
+	for _, c := range s {
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f') {
+			return false
+		}
+	}
+	return true
+}
@@ -1,14 +1,107 @@
 package common
 
 import (
-	"crypto/sha256"
+	"crypto/rand"
 	"encoding/hex"
-	"strconv"
+	"errors"
+	"strings"
 )
 
+// the kinds of user-visible ID, used as the first char of ID
+const (
+	GroupIdPrefix = 'G'
+	UserIdPrefix  = 'U'
+)
+
+// LegacyIdLength the length of legacy user-visible ID, which is the first 5 hex chars of SHA-256(id)
+const LegacyIdLength = 5
+
+// the alphabet of Crockford's base32, which excludes I, L, O and U to avoid confusion
+const idAlphabet = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// the raw ID is permuted in 40 bits, so the user-visible ID is not sequential but still unique
+const (
+	idBits       = 40
+	idMask       = 1<<idBits - 1
+	idMultiplier = 0x9E3779B97F & idMask // must be odd to be invertible
+	idXor        = 0x5A3C96E1F2
+)
+
+// the modular inverse of idMultiplier, computed by Newton's iteration
+var idInverse = func() uint64 {
+	inv := uint64(idMultiplier)
+	for i := 0; i < 5; i++ {
+		inv *= 2 - idMultiplier*inv
+	}
+	return inv & idMask
+}()
+
 // GenerateId Generate user-visible ID from raw ID
-/* Just use 5 chars as user-visible ID, because of little amount of groups and users */
-func GenerateId(id uint) string {
-	hash := sha256.Sum256([]byte(strconv.Itoa(int(id))))
-	return hex.EncodeToString(hash[:])[:5]
+/*
+The ID is prefix + 8 base32 chars + 1 checksum char, such as "G3K8Z1QW7X".
+The 8 chars encode a bijective permutation of raw ID, so two raw IDs never share a user-visible ID,
+and the checksum char catches most typos before querying DB.
+*/
+func GenerateId(prefix byte, id uint) string {
+	v := (uint64(id)*idMultiplier)&idMask ^ idXor
+	buf := make([]byte, 0, 10)
+	buf = append(buf, prefix)
+	for i := idBits/5 - 1; i >= 0; i-- {
+		buf = append(buf, idAlphabet[(v>>(uint(i)*5))&31])
+	}
+	buf = append(buf, idAlphabet[idChecksum(buf[1:])])
+	return string(buf)
+}
+
+// ParseId Get raw ID from user-visible ID, return error if prefix or checksum is wrong
+func ParseId(prefix byte, publicId string) (uint, error) {
+	publicId = normalizeId(publicId)
+	if len(publicId) != idBits/5+2 || publicId[0] != prefix {
+		return 0, errors.New("invalid id")
+	}
+	body := publicId[1 : len(publicId)-1]
+	var v uint64
+	for i := 0; i < len(body); i++ {
+		n := strings.IndexByte(idAlphabet, body[i])
+		if n < 0 {
+			return 0, errors.New("invalid id")
+		}
+		v = v<<5 | uint64(n)
+	}
+	if idAlphabet[idChecksum([]byte(body))] != publicId[len(publicId)-1] {
+		return 0, errors.New("invalid id checksum")
+	}
+	return uint(((v ^ idXor) * idInverse) & idMask), nil
+}
+
+// IsLegacyId check if the user-visible ID is generated by the legacy scheme
+func IsLegacyId(publicId string) bool {
+	if len(publicId) != LegacyIdLength {
+		return false
+	}
+	_, err := hex.DecodeString(publicId + "0")
+	return err == nil
+}
+
+// normalizeId accept lower case and the chars which are easy to be confused
+func normalizeId(publicId string) string {
+	return strings.NewReplacer("O", "0", "I", "1", "L", "1").Replace(strings.ToUpper(strings.TrimSpace(publicId)))
+}
+
+// idChecksum return the weighted sum of chars mod 32
+func idChecksum(body []byte) int {
+	sum := 0
+	for i, c := range body {
+		sum += (i + 1) * strings.IndexByte(idAlphabet, c)
+	}
+	return sum % 32
+}
+
+// RandomToken Generate a random hex token with n bytes, used in links which cannot be guessed
+func RandomToken(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
 }
@@ -0,0 +1,539 @@
+package common
+
+import (
+	"errors"
+	"html"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// MaxMarkdownLength the max length of markdown source in a message
+const MaxMarkdownLength = 4096
+
+// RichText is the result of parsing a markdown message
+/*
+the params are:
+	* Markdown: the normalized markdown source, which is stored as message content
+	* Html: the sanitized html rendered for the web client
+	* Plain: the plain-text fallback used in notifications and search
+*/
+type RichText struct {
+	Markdown string
+	Html     string
+	Plain    string
+}
+
+// the supported link schemes, anything else (such as javascript:) is rejected
+var linkSchemes = map[string]bool{"http": true, "https": true, "mailto": true}
+
+var (
+	orderedItem = regexp.MustCompile(`^\d{1,9}[.)] `)
+	codeLang    = regexp.MustCompile(`^[A-Za-z0-9_+-]{1,20}$`)
+)
+
+// ParseMarkdown validate the markdown source and return its normalized, html and plain-text representation
+/*
+Only a safe subset of markdown is supported:
+	* **bold**, _italic_ or *italic*, `inline code`
+	* [text](url) links with http, https or mailto scheme
+	* ``` fenced code blocks
+	* "- item" unordered lists and "1. item" ordered lists
+Raw html in the source is always escaped, so it will never reach the web client as markup.
+*/
+func ParseMarkdown(src string) (*RichText, error) {
+	if len(src) > MaxMarkdownLength {
+		return nil, errors.New("markdown content is too long")
+	}
+	blocks, err := parseBlocks(strings.ReplaceAll(src, "\r\n", "\n"))
+	if err != nil {
+		return nil, err
+	}
+
+	var md, h, plain []string
+	for _, b := range blocks {
+		md = append(md, b.markdown())
+		h = append(h, b.html())
+		plain = append(plain, b.plain())
+	}
+	return &RichText{
+		Markdown: strings.Join(md, "\n\n"),
+		Html:     strings.Join(h, ""),
+		Plain:    strings.Join(plain, "\n"),
+	}, nil
+}
+
+// PlainText return the plain-text fallback of markdown source, and the source itself if it is invalid
+func PlainText(src string) string {
+	rich, err := ParseMarkdown(src)
+	if err != nil {
+		return src
+	}
+	return rich.Plain
+}
+
+// block level elements
+const (
+	blockParagraph = iota
+	blockCode
+	blockUnorderedList
+	blockOrderedList
+)
+
+type mdBlock struct {
+	kind  int
+	lang  string         // language of code block
+	code  string         // raw content of code block
+	lines [][]inlineNode // lines of paragraph or items of list
+}
+
+func parseBlocks(src string) ([]mdBlock, error) {
+	blocks := make([]mdBlock, 0)
+	var cur *mdBlock
+	flush := func() {
+		if cur != nil {
+			blocks = append(blocks, *cur)
+			cur = nil
+		}
+	}
+
+	lines := strings.Split(src, "\n")
+	for i := 0; i < len(lines); i++ {
+		// the markers are detected on the trimmed line, the same one parsed as paragraph
+		line := strings.TrimSpace(lines[i])
+
+		// fenced code block, an unterminated fence is closed at the end of message
+		if strings.HasPrefix(line, "```") {
+			flush()
+			lang := strings.TrimSpace(line[3:])
+			if !codeLang.MatchString(lang) {
+				lang = ""
+			}
+			code := make([]string, 0)
+			for i++; i < len(lines) && strings.TrimRight(lines[i], " \t") != "```"; i++ {
+				code = append(code, lines[i])
+			}
+			blocks = append(blocks, mdBlock{kind: blockCode, lang: lang, code: strings.TrimRight(strings.Join(code, "\n"), "\n")})
+			continue
+		}
+
+		if line == "" {
+			flush()
+			continue
+		}
+
+		kind, text := blockParagraph, line
+		if strings.HasPrefix(line, "- ") || strings.HasPrefix(line, "* ") || strings.HasPrefix(line, "+ ") {
+			kind, text = blockUnorderedList, line[2:]
+		} else if loc := orderedItem.FindStringIndex(line); loc != nil {
+			kind, text = blockOrderedList, line[loc[1]:]
+		}
+
+		nodes, err := parseInline(strings.TrimLeft(text, " \t"), true)
+		if err != nil {
+			return nil, err
+		}
+		if cur == nil || cur.kind != kind {
+			flush()
+			cur = &mdBlock{kind: kind}
+		}
+		cur.lines = append(cur.lines, nodes)
+	}
+	flush()
+	return blocks, nil
+}
+
+func (b mdBlock) markdown() string {
+	switch b.kind {
+	case blockCode:
+		return "```" + b.lang + "\n" + b.code + "\n```"
+	case blockUnorderedList, blockOrderedList:
+		items := make([]string, 0, len(b.lines))
+		for i, l := range b.lines {
+			prefix := "- "
+			if b.kind == blockOrderedList {
+				prefix = strconv.Itoa(i+1) + ". "
+			}
+			items = append(items, prefix+renderInline(l, inlineMarkdown))
+		}
+		return strings.Join(items, "\n")
+	default:
+		// the text looks like a list marker is escaped, so it is still a paragraph when parsed again
+		lines := make([]string, 0, len(b.lines))
+		for _, l := range b.lines {
+			line := renderInline(l, inlineMarkdown)
+			if strings.HasPrefix(line, "- ") || strings.HasPrefix(line, "+ ") {
+				line = "\\" + line
+			} else if loc := orderedItem.FindStringIndex(line); loc != nil {
+				line = line[:loc[1]-2] + "\\" + line[loc[1]-2:]
+			}
+			lines = append(lines, line)
+		}
+		return strings.Join(lines, "\n")
+	}
+}
+
+func (b mdBlock) html() string {
+	switch b.kind {
+	case blockCode:
+		if b.lang != "" {
+			return `<pre><code class="language-` + b.lang + `">` + html.EscapeString(b.code) + "</code></pre>"
+		}
+		return "<pre><code>" + html.EscapeString(b.code) + "</code></pre>"
+	case blockUnorderedList, blockOrderedList:
+		tag := "ul"
+		if b.kind == blockOrderedList {
+			tag = "ol"
+		}
+		var sb strings.Builder
+		sb.WriteString("<" + tag + ">")
+		for _, l := range b.lines {
+			sb.WriteString("<li>" + renderInline(l, inlineHtml) + "</li>")
+		}
+		sb.WriteString("</" + tag + ">")
+		return sb.String()
+	default:
+		return "<p>" + b.join(inlineHtml, "<br>") + "</p>"
+	}
+}
+
+func (b mdBlock) plain() string {
+	switch b.kind {
+	case blockCode:
+		return b.code
+	case blockUnorderedList, blockOrderedList:
+		items := make([]string, 0, len(b.lines))
+		for i, l := range b.lines {
+			prefix := "- "
+			if b.kind == blockOrderedList {
+				prefix = strconv.Itoa(i+1) + ". "
+			}
+			items = append(items, prefix+renderInline(l, inlinePlain))
+		}
+		return strings.Join(items, "\n")
+	default:
+		return b.join(inlinePlain, "\n")
+	}
+}
+
+func (b mdBlock) join(format int, sep string) string {
+	lines := make([]string, 0, len(b.lines))
+	for _, l := range b.lines {
+		lines = append(lines, renderInline(l, format))
+	}
+	return strings.Join(lines, sep)
+}
+
+// inline level elements
+const (
+	inlineText = iota
+	inlineCode
+	inlineBold
+	inlineItalic
+	inlineLink
+)
+
+// the output format of inline elements
+const (
+	inlineMarkdown = iota
+	inlineHtml
+	inlinePlain
+)
+
+type inlineNode struct {
+	kind     int
+	text     string // content of text and code, or url of link
+	children []inlineNode
+}
+
+// inlineState is where and how the inline elements are parsed
+/*
+the params are:
+	* pos: the position to start from
+	* stop: the mark closing the current bold or italic, empty at the top level
+	* inItalic, inBold: if it is inside an italic or bold, which can not be nested in itself
+*/
+type inlineState struct {
+	pos      int
+	stop     string
+	inItalic bool
+	inBold   bool
+}
+
+type inlineResult struct {
+	nodes  []inlineNode
+	end    int  // the position after the closing mark
+	closed bool // if the closing mark is found
+	err    error
+}
+
+// inlineParser parse the inline elements of a line by recursive descent
+/* a bold or italic is tried first and falls back to text if it is not closed, the results are memorized by state
+so the backtracking costs no more than a few scans of the line */
+type inlineParser struct {
+	s         string
+	allowLink bool
+	memo      map[inlineState]inlineResult
+}
+
+func parseInline(s string, allowLink bool) ([]inlineNode, error) {
+	p := inlineParser{s: s, allowLink: allowLink, memo: make(map[inlineState]inlineResult)}
+	r := p.parse(inlineState{})
+	return r.nodes, r.err
+}
+
+func (p *inlineParser) parse(st inlineState) inlineResult {
+	if r, ok := p.memo[st]; ok {
+		return r
+	}
+	r := p.scan(st)
+	p.memo[st] = r
+	return r
+}
+
+func (p *inlineParser) scan(st inlineState) inlineResult {
+	s := p.s
+	nodes := make([]inlineNode, 0)
+	var buf strings.Builder
+	flush := func() {
+		if buf.Len() > 0 {
+			nodes = append(nodes, inlineNode{kind: inlineText, text: buf.String()})
+			buf.Reset()
+		}
+	}
+	closeAt := func(end int) inlineResult {
+		flush()
+		return inlineResult{nodes: nodes, end: end, closed: true}
+	}
+	// tryContainer parse the bold or italic opened by mark at i, it returns the position after it if it is closed
+	tryContainer := func(i int, kind int, mark string) (int, bool, error) {
+		r := p.parse(inlineState{
+			pos:      i + len(mark),
+			stop:     mark,
+			inItalic: st.inItalic || kind == inlineItalic,
+			inBold:   st.inBold || kind == inlineBold,
+		})
+		if r.err != nil || !r.closed || len(r.nodes) == 0 {
+			return 0, false, r.err
+		}
+		flush()
+		nodes = append(nodes, normalizeEmphasis(inlineNode{kind: kind, children: r.nodes}))
+		return r.end, true, nil
+	}
+
+	for i := st.pos; i < len(s); {
+		c := s[i]
+		switch {
+		case c == '\\' && i+1 < len(s) && strings.IndexByte(escapableChars, s[i+1]) >= 0:
+			buf.WriteByte(s[i+1])
+			i += 2
+			continue
+		case c == '`':
+			if end := strings.IndexByte(s[i+1:], '`'); end > 0 {
+				flush()
+				nodes = append(nodes, inlineNode{kind: inlineCode, text: s[i+1 : i+1+end]})
+				i += end + 2
+				continue
+			}
+		case c == '*':
+			run := len(s[i:]) - len(strings.TrimLeft(s[i:], "*"))
+			// a run of 3 closes the italic before a bold, or the bold after an italic
+			if st.stop == "**" && run >= 2 {
+				return closeAt(i + 2)
+			}
+			if st.stop == "*" && run != 2 {
+				return closeAt(i + 1)
+			}
+			// "**" opens a bold, and "***" opens an italic starting with a bold (see writeMarkdown)
+			marks := []string{"**", "*"}
+			if run >= 3 {
+				marks = []string{"*", "**"}
+			}
+			opened := false
+			for _, mark := range marks {
+				if mark == "**" && (run < 2 || st.inBold) || mark == "*" && (st.inItalic || i+1 >= len(s) || s[i+1] == ' ') {
+					continue
+				}
+				kind := inlineBold
+				if mark == "*" {
+					kind = inlineItalic
+				}
+				end, ok, err := tryContainer(i, kind, mark)
+				if err != nil {
+					return inlineResult{err: err}
+				}
+				if ok {
+					i, opened = end, true
+					break
+				}
+			}
+			if opened {
+				continue
+			}
+			if st.stop == "*" {
+				return closeAt(i + 1)
+			}
+		case c == '_':
+			if st.stop == "_" {
+				return closeAt(i + 1)
+			}
+			// the underscore inside a word (such as snake_case) is not a mark
+			if !st.inItalic && (i == 0 || !isWordByte(s[i-1])) && i+1 < len(s) && s[i+1] != ' ' {
+				end, ok, err := tryContainer(i, inlineItalic, "_")
+				if err != nil {
+					return inlineResult{err: err}
+				}
+				if ok {
+					i = end
+					continue
+				}
+			}
+		case c == '[' && p.allowLink:
+			if mid := findLinkMid(s[i:]); mid > 1 {
+				if end := strings.IndexByte(s[i+mid+2:], ')'); end > 0 {
+					href := s[i+mid+2 : i+mid+2+end]
+					if err := checkLink(href); err != nil {
+						return inlineResult{err: err}
+					}
+					children, err := parseInline(s[i+1:i+mid], false)
+					if err != nil {
+						return inlineResult{err: err}
+					}
+					flush()
+					nodes = append(nodes, inlineNode{kind: inlineLink, text: href, children: children})
+					i += mid + end + 3
+					continue
+				}
+			}
+		}
+		buf.WriteByte(c)
+		i++
+	}
+	flush()
+	return inlineResult{nodes: nodes, end: len(s), closed: st.stop == ""}
+}
+
+// the characters which can be escaped by backslash
+const escapableChars = "\\`*_[]().-+"
+
+// findLinkMid return the index of "](" ending the text of link s, the escaped characters and inline code are skipped
+func findLinkMid(s string) int {
+	for i := 1; i < len(s); i++ {
+		switch {
+		case s[i] == '\\' && i+1 < len(s) && strings.IndexByte(escapableChars, s[i+1]) >= 0:
+			i++
+		case s[i] == '`':
+			if end := strings.IndexByte(s[i+1:], '`'); end > 0 {
+				i += end + 1
+			}
+		case strings.HasPrefix(s[i:], "]("):
+			return i
+		}
+	}
+	return -1
+}
+
+// normalizeEmphasis turn an italic wrapping only a bold into a bold wrapping an italic, so "***x***" has one form
+/* it is skipped if the bold starts with a space, because an italic can not */
+func normalizeEmphasis(n inlineNode) inlineNode {
+	if n.kind == inlineItalic && len(n.children) == 1 && n.children[0].kind == inlineBold &&
+		!strings.HasPrefix(renderInline(n.children[0].children, inlinePlain), " ") {
+		return inlineNode{kind: inlineBold, children: []inlineNode{{kind: inlineItalic, children: n.children[0].children}}}
+	}
+	return n
+}
+
+func isWordByte(c byte) bool {
+	return c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// checkLink only allow absolute links with a safe scheme
+func checkLink(href string) error {
+	u, err := url.Parse(href)
+	if err != nil || strings.ContainsAny(href, " \t\"'<>") {
+		return errors.New("invalid link: " + href)
+	}
+	if !linkSchemes[strings.ToLower(u.Scheme)] {
+		return errors.New("unsupported link scheme: " + href)
+	}
+	return nil
+}
+
+// the characters should be escaped when writing text back to markdown
+var markdownEscaper = strings.NewReplacer(`\`, `\\`, "`", "\\`", `*`, `\*`, `_`, `\_`, `[`, `\[`, `]`, `\]`)
+
+// writeMarkdown write the nodes as normalized markdown, which is parsed back into the same nodes
+/* the italic is written as _x_, or as *x* after a word character, where the underscore is not a mark */
+func writeMarkdown(sb *strings.Builder, nodes []inlineNode) {
+	for _, n := range nodes {
+		switch n.kind {
+		case inlineText:
+			sb.WriteString(markdownEscaper.Replace(n.text))
+		case inlineCode:
+			sb.WriteString("`" + n.text + "`")
+		case inlineBold, inlineItalic:
+			mark := "**"
+			if n.kind == inlineItalic {
+				mark = "_"
+				if out := sb.String(); out != "" && isWordByte(out[len(out)-1]) {
+					mark = "*"
+				}
+			}
+			sb.WriteString(mark)
+			writeMarkdown(sb, n.children)
+			sb.WriteString(mark)
+		case inlineLink:
+			sb.WriteString("[")
+			writeMarkdown(sb, n.children)
+			sb.WriteString("](" + n.text + ")")
+		}
+	}
+}
+
+func renderInline(nodes []inlineNode, format int) string {
+	var sb strings.Builder
+	if format == inlineMarkdown {
+		writeMarkdown(&sb, nodes)
+		return sb.String()
+	}
+	for _, n := range nodes {
+		switch n.kind {
+		case inlineText:
+			switch format {
+			case inlineHtml:
+				sb.WriteString(html.EscapeString(n.text))
+			default:
+				sb.WriteString(n.text)
+			}
+		case inlineCode:
+			switch format {
+			case inlineHtml:
+				sb.WriteString("<code>" + html.EscapeString(n.text) + "</code>")
+			default:
+				sb.WriteString(n.text)
+			}
+		case inlineBold, inlineItalic:
+			inner := renderInline(n.children, format)
+			tag := "strong"
+			if n.kind == inlineItalic {
+				tag = "em"
+			}
+			switch format {
+			case inlineHtml:
+				sb.WriteString("<" + tag + ">" + inner + "</" + tag + ">")
+			default:
+				sb.WriteString(inner)
+			}
+		case inlineLink:
+			inner := renderInline(n.children, format)
+			switch format {
+			case inlineHtml:
+				sb.WriteString(`<a href="` + html.EscapeString(n.text) + `" target="_blank" rel="noopener noreferrer nofollow">` + inner + "</a>")
+			default:
+				sb.WriteString(inner + " (" + n.text + ")")
+			}
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,48 @@
+package common
+
+import "testing"
+
+// the normalized markdown stored as message content should be parsed into the same html again
+func TestMarkdownRoundTrip(t *testing.T) {
+	sources := []string{
+		"**bold**, _italic_ and *italic*",
+		"snake_case_name and foo_bar_",
+		"under_*it*_x",
+		"***x***",
+		"_**b** a_",
+		"x *a **b** c* y",
+		"**a** *b* _c_",
+		"*a***b**",
+		"**a *x***",
+		"a*b and **a*b**",
+		"*a \\* b*",
+		" 1. x",
+		" - a",
+		"a\n - ```",
+		"9\\) not a list",
+		"\\- not a list",
+		"_&*<)[b[a*_",
+		"_**\\**_b",
+		" - _** **_x",
+		"[a\\](b](http://x)",
+		"[]\\()x](http://x/a_b*c)",
+		"see [the *docs*](https://example.com/a_b) or `code_*x*`",
+		"- one\n- two\n\n1. first\n2) second",
+		"```go\nfmt.Println(\"**\")\n```\nafter",
+	}
+	for _, src := range sources {
+		first, err := ParseMarkdown(src)
+		if err != nil {
+			t.Errorf("ParseMarkdown(%q): %v", src, err)
+			continue
+		}
+		second, err := ParseMarkdown(first.Markdown)
+		if err != nil {
+			t.Errorf("ParseMarkdown(%q) of %q: %v", first.Markdown, src, err)
+			continue
+		}
+		if second.Html != first.Html {
+			t.Errorf("%q is stored as %q\nhtml:    %q\nparsed:  %q", src, first.Markdown, first.Html, second.Html)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package dao
+
+import (
+	"HiChat/global"
+	"HiChat/models"
+	"errors"
+	"go.uber.org/zap"
+)
+
+// BlockUser add the target user into the block list of user, the pending friend requests and follows between them are closed
+/* the friend relation is kept, but the messages, calls, friend requests and presence are suppressed */
+func BlockUser(userId uint, targetId uint) error {
+	if userId == targetId {
+		zap.S().Info("userId cannot equal to targetId")
+		return errors.New("cannot block yourself")
+	}
+	targetUser, err := GetUserById(targetId)
+	if err != nil || targetUser.ID == 0 {
+		zap.S().Info("Target User is not exist")
+		return errors.New("target User is not exist")
+	}
+	if models.IsBlocked(userId, targetId) {
+		zap.S().Info("User has been blocked")
+		return errors.New("user has been blocked")
+	}
+
+	tx := global.DB.Begin()
+	relation := models.Relation{OwnerId: userId, TargetId: targetId, Type: 3}
+	if t := tx.Create(&relation); t.RowsAffected == 0 {
+		tx.Rollback()
+		zap.S().Info("Failed to Create Relation")
+		return errors.New("failed to block user")
+	}
+	t := tx.Model(&models.FriendRequest{}).
+		Where("((from_id = ? and to_id = ?) or (from_id = ? and to_id = ?)) and status = ?", userId, targetId, targetId, userId, models.FriendRequestPending).
+		Update("status", models.FriendRequestIgnored)
+	if t.Error != nil {
+		tx.Rollback()
+		zap.S().Info("Failed to close friend requests")
+		return errors.New("failed to block user")
+	}
+	t = tx.Where("((owner_id = ? and target_id = ?) or (owner_id = ? and target_id = ?)) and type = 4", userId, targetId, targetId, userId).
+		Delete(&models.Relation{})
+	if t.Error != nil {
+		tx.Rollback()
+		zap.S().Info("Failed to remove follow relations")
+		return errors.New("failed to block user")
+	}
+	tx.Commit()
+	models.InvalidateRecommendations(userId, targetId)
+	return nil
+}
+
+// UnblockUser remove the target user from the block list of user
+func UnblockUser(userId uint, targetId uint) error {
+	if tx := global.DB.Where("owner_id = ? and target_id = ? and type = 3", userId, targetId).Delete(&models.Relation{}); tx.RowsAffected == 0 {
+		zap.S().Info("User is not blocked")
+		return errors.New("user is not blocked")
+	}
+	models.InvalidateRecommendations(userId, targetId)
+	return nil
+}
+
+// GetBlockList return the users blocked by user
+func GetBlockList(userId uint) ([]*models.UserBasic, error) {
+	blockedId := make([]uint, 0)
+	if tx := global.DB.Model(&models.Relation{}).Where("owner_id = ? and type = 3", userId).Pluck("target_id", &blockedId); tx.Error != nil {
+		zap.S().Info("Failed to get block list")
+		return nil, errors.New("failed to get block list")
+	}
+	return GetUsersByIds(blockedId)
+}
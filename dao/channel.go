@@ -0,0 +1,153 @@
+package dao
+
+import (
+	"HiChat/global"
+	"HiChat/models"
+	"errors"
+	"go.uber.org/zap"
+)
+
+// ChannelView is a channel in community with the unread counter of user
+type ChannelView struct {
+	models.GroupChannel
+	Unread int64 `json:"unread"`
+}
+
+// CreateChannel create a named channel in group, only the member who can manage channel can create it
+func CreateChannel(userId uint, gid string, channel models.GroupChannel) (*models.GroupChannel, error) {
+	if channel.Name == "" {
+		zap.S().Info("Channel name is empty")
+		return nil, errors.New("channel name can not be empty")
+	}
+	if channel.PostRole < models.RoleMember || channel.PostRole > models.RoleOwner {
+		zap.S().Info("Invalid post role")
+		return nil, errors.New("invalid post role")
+	}
+	group, err := checkGroupPermission(userId, gid, models.PermManageChannel)
+	if err != nil {
+		return nil, err
+	}
+	if tx := global.DB.Where("community_id = ? and name = ?", group.ID, channel.Name).First(&models.GroupChannel{}); tx.RowsAffected != 0 {
+		zap.S().Info("Channel has existed")
+		return nil, errors.New("channel has existed")
+	}
+
+	channel.CommunityId = group.ID
+	channel.CreatorId = userId
+	if tx := global.DB.Create(&channel); tx.RowsAffected == 0 {
+		zap.S().Info("Failed to create channel")
+		return nil, errors.New("failed to create channel")
+	}
+	return &channel, nil
+}
+
+// UpdateChannel update the name, topic and post role of channel
+/* the empty name and topic are not changed, and postRole is nil if it is not changed */
+func UpdateChannel(userId uint, gid string, channel models.GroupChannel, postRole *int) (*models.GroupChannel, error) {
+	group, err := checkGroupPermission(userId, gid, models.PermManageChannel)
+	if err != nil {
+		return nil, err
+	}
+	cur, err := models.FindChannel(group.ID, channel.ID)
+	if err != nil {
+		return nil, err
+	}
+	if postRole != nil && (*postRole < models.RoleMember || *postRole > models.RoleOwner) {
+		zap.S().Info("Invalid post role")
+		return nil, errors.New("invalid post role")
+	}
+	if channel.Name != "" && channel.Name != cur.Name {
+		if tx := global.DB.Where("community_id = ? and name = ?", group.ID, channel.Name).First(&models.GroupChannel{}); tx.RowsAffected != 0 {
+			zap.S().Info("Channel has existed")
+			return nil, errors.New("channel has existed")
+		}
+	}
+
+	// post role can be reset to member, so the columns are updated by map
+	updates := make(map[string]interface{})
+	if postRole != nil {
+		updates["post_role"] = *postRole
+	}
+	if channel.Name != "" {
+		updates["name"] = channel.Name
+	}
+	if channel.Topic != "" {
+		updates["topic"] = channel.Topic
+	}
+	if len(updates) == 0 {
+		return cur, nil
+	}
+	if tx := global.DB.Model(cur).Updates(updates); tx.Error != nil {
+		zap.S().Info("Failed to update channel")
+		return nil, errors.New("failed to update channel")
+	}
+	return models.FindChannel(group.ID, channel.ID)
+}
+
+// DeleteChannel delete the channel with its records and pins
+func DeleteChannel(userId uint, gid string, channelId uint) error {
+	group, err := checkGroupPermission(userId, gid, models.PermManageChannel)
+	if err != nil {
+		return err
+	}
+	channel, err := models.FindChannel(group.ID, channelId)
+	if err != nil {
+		return err
+	}
+	if tx := global.DB.Delete(channel); tx.RowsAffected == 0 {
+		zap.S().Info("Failed to delete channel")
+		return errors.New("failed to delete channel")
+	}
+	models.DelChannelRecords(group.ID, channelId)
+	return nil
+}
+
+// GetChannels return the channels of group with the unread counters of user
+func GetChannels(userId uint, gid string) ([]ChannelView, error) {
+	group, err := checkGroupMember(userId, gid)
+	if err != nil {
+		return nil, err
+	}
+	channels := make([]models.GroupChannel, 0)
+	if tx := global.DB.Where("community_id = ?", group.ID).Order("id").Find(&channels); tx.Error != nil {
+		zap.S().Info("Failed to get channels")
+		return nil, errors.New("failed to get channels")
+	}
+
+	channelsId := make([]uint, 0, len(channels))
+	for _, c := range channels {
+		channelsId = append(channelsId, c.ID)
+	}
+	unread := models.GetChannelUnread(userId, group.ID, channelsId)
+	views := make([]ChannelView, 0, len(channels))
+	for _, c := range channels {
+		views = append(views, ChannelView{GroupChannel: c, Unread: unread[c.ID]})
+	}
+	return views, nil
+}
+
+// CheckChannelAccess check if user is the member of group and the channel exists, return the group
+func CheckChannelAccess(userId uint, gid string, channelId uint) (*models.Community, error) {
+	group, err := checkGroupMember(userId, gid)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = models.FindChannel(group.ID, channelId); err != nil {
+		return nil, err
+	}
+	return group, nil
+}
+
+// checkGroupMember check if user is the member of group
+func checkGroupMember(userId uint, gid string) (*models.Community, error) {
+	group, err := FindGroupByGid(gid)
+	if err != nil {
+		zap.S().Info("Group is not exist")
+		return nil, gidError(err, "group is not exist")
+	}
+	if !IsGroupMember(userId, group.ID) {
+		zap.S().Info("User is not the member of group")
+		return nil, errors.New("user is not the member of group")
+	}
+	return group, nil
+}
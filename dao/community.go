@@ -1,10 +1,14 @@
 package dao
 
 import (
+	"HiChat/common"
 	"HiChat/global"
 	"HiChat/models"
 	"errors"
 	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
 )
 
 // GetGroupList return a group list which user has joined in
@@ -36,6 +40,12 @@ func CreateCommunity(community models.Community) error {
 		zap.S().Info("Cannot create another group which has same Name and Owner")
 		return errors.New("cannot create another group which has same Name and Owner")
 	}
+	if community.Type == 0 {
+		community.Type = models.GroupTypeSmall
+	} else if !models.IsValidGroupType(community.Type) {
+		zap.S().Info("Group type is invalid")
+		return errors.New("group type is invalid")
+	}
 	// create new community record in Table Community and Relation
 	tx := global.DB.Begin()
 	if t := tx.Create(&community); t.RowsAffected == 0 {
@@ -59,11 +69,14 @@ func CreateCommunity(community models.Community) error {
 	return nil
 }
 
-// FindGroupByName Find group list by group name
-func FindGroupByName(name string) (*[]models.Community, error) {
+// FindGroupByName Find a page of groups by group name, only the public groups and the groups user has joined in are found
+func FindGroupByName(userId uint, name string, page int, size int) (*[]models.Community, error) {
 	// Get Communities Record
 	communities := make([]models.Community, 0)
-	if tx := global.DB.Where("name = ?", name).Find(&communities); tx.RowsAffected == 0 {
+	joined := global.DB.Model(&models.Relation{}).Select("target_id").Where("owner_id = ? and type = 2", userId)
+	tx := global.DB.Where("name = ? and (is_public = ? or id in (?))", name, true, joined).
+		Order("id").Offset((page - 1) * size).Limit(size).Find(&communities)
+	if tx.RowsAffected == 0 {
 		zap.S().Info("Cannot Find Communities Record")
 		return nil, errors.New("cannot Find Communities Record")
 	}
@@ -71,58 +84,161 @@ func FindGroupByName(name string) (*[]models.Community, error) {
 	return &communities, nil
 }
 
-// FindGroupByGid Find group list by group Gid
+// FindGroupByGid Find group by group Gid, the legacy 5-char gid is also accepted
 func FindGroupByGid(groupId string) (*models.Community, error) {
-	// Get Community Record
-	community := models.Community{}
-	if tx := global.DB.Where("group_id = ?", groupId).Find(&community); tx.RowsAffected == 0 {
+	return findGroupByGid(global.DB, groupId)
+}
+
+// errAmbiguousGid the legacy ids are short hashes, so several groups may share one of them
+var errAmbiguousGid = errors.New("the legacy group id is shared by several groups, please use the new group id")
+
+// findGroupByGid find the group by Gid in db, return errAmbiguousGid instead of an arbitrary one of the groups sharing a legacy id
+func findGroupByGid(db *gorm.DB, groupId string) (*models.Community, error) {
+	groups := make([]models.Community, 0, 2)
+	query, arg := gidCondition(groupId)
+	if tx := db.Where(query, arg).Limit(2).Find(&groups); tx.RowsAffected == 0 {
 		zap.S().Info("Cannot Find Community Record")
 		return nil, errors.New("cannot Find Community Record")
 	}
+	if len(groups) > 1 {
+		zap.S().Info("Ambiguous legacy group id")
+		return nil, errAmbiguousGid
+	}
+	return &groups[0], nil
+}
 
-	return &community, nil
+// gidError return the error of finding group by Gid, the ambiguous one is kept so the user knows to use the new id
+func gidError(err error, notFound string) error {
+	if errors.Is(err, errAmbiguousGid) {
+		return err
+	}
+	return errors.New(notFound)
 }
 
-// JoinInCommunityByGId join in group by gid
-func JoinInCommunityByGId(userId uint, groupId string) error {
-	community := models.Community{}
-	relation := models.Relation{}
+// gidCondition return the query condition of group Gid
+func gidCondition(groupId string) (string, interface{}) {
+	if common.IsLegacyId(groupId) {
+		return "legacy_group_id = ?", groupId
+	} else if id, err := common.ParseId(common.GroupIdPrefix, groupId); err == nil {
+		return "id = ?", id
+	}
+	return "group_id = ?", groupId
+}
 
+// JoinInCommunityByGId join in group by gid according to the join policy of group
+/* return the result message, because a join request is created instead if the group requires approval */
+func JoinInCommunityByGId(userId uint, groupId string, greeting string) (string, error) {
 	// check if group exist
-	if tx := global.DB.Where("group_id = ?", groupId).First(&community); tx.RowsAffected == 0 {
+	community, err := FindGroupByGid(groupId)
+	if err != nil {
 		zap.S().Info("Target Community did not exist")
-		return errors.New("target Community did not exist")
+		return "", gidError(err, "target Community did not exist")
 	}
 
-	// check if user has join in before
+	// check if user can join in the group
 	cid := community.ID
-	if tx := global.DB.Where("owner_id = ? and target_id = ? and type = 2", userId, cid).First(&relation); tx.RowsAffected != 0 {
-		zap.S().Info("User had join in before")
-		return errors.New("user had join in before")
+	if err := checkJoinIn(userId, cid); err != nil {
+		return "", err
 	}
 
-	// add record in relation table
-	relation = models.Relation{}
-	relation.OwnerId = userId
-	relation.TargetId = cid
-	relation.Type = 2
+	switch community.JoinPolicy {
+	case models.JoinByApproval:
+		return createJoinRequest(userId, community, greeting)
+	case models.JoinByInvite:
+		zap.S().Info("Group is invite-only")
+		return "", errors.New("group is invite-only, please join in by invite link")
+	}
 
-	if tx := global.DB.Create(&relation); tx.RowsAffected == 0 {
-		zap.S().Info("failed to join in group")
-		return errors.New("failed to join in group")
+	if err := addMember(global.DB, userId, cid); err != nil {
+		return "", err
 	}
+	return "Successfully join group!", nil
+}
 
+// checkJoinIn check if user is banned or has joined in the group
+func checkJoinIn(userId uint, cid uint) error {
+	// check if user is banned from the group
+	if models.IsBanned(userId, cid) {
+		zap.S().Info("User is banned from the group")
+		return errors.New("you are banned from the group")
+	}
+
+	// check if user has join in before
+	if IsGroupMember(userId, cid) {
+		zap.S().Info("User had join in before")
+		return errors.New("user had join in before")
+	}
 	return nil
 }
 
-// UpdateCommunityInformation update ownerId, name, type, image and desc information by gid
+// addMember add record in relation table if the group is not full, db can be a transaction
+/* the community row is locked before counting, so the concurrent joins can not exceed the max members */
+func addMember(db *gorm.DB, userId uint, cid uint) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		community := models.Community{}
+		if t := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", cid).First(&community); t.RowsAffected == 0 {
+			zap.S().Info("Community is not exist")
+			return errors.New("group is not exist")
+		}
+		if models.CountMembers(tx, cid) >= models.GetGroupTypeConfig(community.Type).MaxMembers {
+			zap.S().Info("Group is full")
+			return errors.New("group is full")
+		}
+
+		relation := models.Relation{}
+		relation.OwnerId = userId
+		relation.TargetId = cid
+		relation.Type = 2
+
+		if t := tx.Create(&relation); t.RowsAffected == 0 {
+			zap.S().Info("failed to join in group")
+			return errors.New("failed to join in group")
+		}
+		return nil
+	})
+}
+
+// UpdateCommunityInformation update name, type, image and desc information by gid
+/* the owner is changed by CreateOwnershipTransfer, which should be accepted by the new owner */
 func UpdateCommunityInformation(userId uint, community models.Community) (*models.Community, error) {
 	// check if community exist
 	group, err := FindGroupByGid(community.GroupId)
-	if group.ID == 0 || err != nil {
+	if err != nil || group.ID == 0 {
 		zap.S().Info("Group is not exist")
-		return nil, errors.New("group is not exist")
+		return nil, gidError(err, "group is not exist")
+	}
+	// check the permission of every modified field
+	role, err := models.GetMemberRole(userId, group.ID)
+	if err != nil {
+		return nil, err
+	}
+	checks := []struct {
+		modified bool
+		perm     int
+	}{
+		{community.Name != "", models.PermRename},
+		{community.Image != "", models.PermChangeAvatar},
+		{community.Type != 0 || community.Desc != "", models.PermEditInfo},
+	}
+	for _, c := range checks {
+		if c.modified && !models.HasPermission(role, c.perm) {
+			zap.S().Info("Permission denied")
+			return nil, errors.New("permission denied")
+		}
+	}
+
+	// the members should not exceed the capacity of new type
+	if community.Type != 0 {
+		if !models.IsValidGroupType(community.Type) {
+			zap.S().Info("Group type is invalid")
+			return nil, errors.New("group type is invalid")
+		}
+		if models.CountMembers(global.DB, group.ID) > models.GetGroupTypeConfig(community.Type).MaxMembers {
+			zap.S().Info("Too many members for the group type")
+			return nil, errors.New("too many members for the group type")
+		}
 	}
+
 	// update
 	newCommunity := models.Community{
 		Name:  community.Name,
@@ -130,42 +246,32 @@ func UpdateCommunityInformation(userId uint, community models.Community) (*model
 		Image: community.Image,
 		Desc:  community.Desc,
 	}
-	// Only group owner can modify OwnerId
-	if group.OwnerId == userId && community.OwnerId != 0 {
-		newCommunity.OwnerId = community.OwnerId
-	}
-	tx := global.DB.Model(&community).Where("group_id = ?", community.GroupId).Updates(&newCommunity)
+	tx := global.DB.Model(group).Updates(&newCommunity)
 	if tx.RowsAffected == 0 {
 		zap.S().Info("Failed to update")
 		return nil, errors.New("failed to update")
 	}
-	return FindGroupByGid(community.GroupId)
+	return FindGroupByGid(group.GroupId)
 }
 
 // DelGroup Delete the group record if user is group owner, otherwise Quit the group
-func DelGroup(userId uint, gid string) (string, error) {
+/* the deleted group can be restored by RestoreGroup in grace period, and policy decides how the history is handled */
+func DelGroup(userId uint, gid string, policy int) (string, error) {
 	// check if community exist
 	group, err := FindGroupByGid(gid)
-	if group.ID == 0 || err != nil {
+	if err != nil || group.ID == 0 {
 		zap.S().Info("Group is not exist")
-		return "", errors.New("group is not exist")
+		return "", gidError(err, "group is not exist")
 	}
-	// check if the user is owner
-	if group.OwnerId == userId {
-		// delete record in Community & Relation
-		tx := global.DB.Begin()
-		if tx := global.DB.Where("id = ? ", group.ID).Delete(&models.Community{}); tx.RowsAffected == 0 {
-			tx.Rollback()
-			zap.S().Info("Failed to delete in Table Community")
-			return "", errors.New("failed to delete")
-		}
-
-		if tx := global.DB.Where("target_id = ? and type = 2", group.ID).Delete(&models.Relation{}); tx.RowsAffected == 0 {
-			tx.Rollback()
-			zap.S().Info("Failed to delete in Table Relation")
-			return "", errors.New("failed to delete")
+	// check if the user can delete the group, otherwise he quit the group
+	role, err := models.GetMemberRole(userId, group.ID)
+	if err != nil {
+		return "", err
+	}
+	if models.HasPermission(role, models.PermDeleteGroup) {
+		if err = deleteGroup(userId, group, policy); err != nil {
+			return "", err
 		}
-		tx.Commit()
 		return "Successfully Delete the group", nil
 	} else {
 		// delete record in Relation
@@ -173,6 +279,177 @@ func DelGroup(userId uint, gid string) (string, error) {
 			zap.S().Info("Failed to delete")
 			return "", errors.New("failed to delete")
 		}
+		models.RemoveFromGroupCall(userId, group.ID)
 		return "Successfully quit the group", nil
 	}
 }
+
+// IsGroupMember check if user has joined in the community
+func IsGroupMember(userId uint, communityId uint) bool {
+	relation := models.Relation{}
+	tx := global.DB.Where("owner_id = ? and target_id = ? and type = 2", userId, communityId).First(&relation)
+	return tx.RowsAffected != 0
+}
+
+// SetMemberRole promote or demote a group member, only group owner can manage admins
+func SetMemberRole(userId uint, gid string, targetId uint, role int) error {
+	if role != models.RoleMember && role != models.RoleAdmin {
+		zap.S().Info("Invalid role")
+		return errors.New("invalid role")
+	}
+	group, err := FindGroupByGid(gid)
+	if err != nil {
+		zap.S().Info("Group is not exist")
+		return gidError(err, "group is not exist")
+	}
+	operatorRole, err := models.GetMemberRole(userId, group.ID)
+	if err != nil {
+		return err
+	}
+	if !models.HasPermission(operatorRole, models.PermManageAdmin) {
+		zap.S().Info("Permission denied")
+		return errors.New("permission denied")
+	}
+	if targetId == group.OwnerId {
+		zap.S().Info("Cannot change the role of owner")
+		return errors.New("cannot change the role of group owner")
+	}
+
+	tx := global.DB.Model(&models.Relation{}).Where("owner_id = ? and target_id = ? and type = 2", targetId, group.ID).Update("role", role)
+	if tx.Error != nil || (tx.RowsAffected == 0 && !IsGroupMember(targetId, group.ID)) {
+		zap.S().Info("Target user is not the member of group")
+		return errors.New("target user is not the member of group")
+	}
+	return nil
+}
+
+// GetMemberList return a page of group members, owner first, then admins and members in order of joining
+func GetMemberList(userId uint, gid string, page int, size int) (*[]models.Relation, *models.Community, int64, error) {
+	group, err := FindGroupByGid(gid)
+	if err != nil {
+		zap.S().Info("Group is not exist")
+		return nil, nil, 0, gidError(err, "group is not exist")
+	}
+	if !IsGroupMember(userId, group.ID) {
+		zap.S().Info("User is not the member of group")
+		return nil, nil, 0, errors.New("user is not the member of group")
+	}
+
+	var total int64
+	query := global.DB.Model(&models.Relation{}).Where("target_id = ? and type = 2", group.ID)
+	if tx := query.Count(&total); tx.Error != nil {
+		zap.S().Info("Failed to count members")
+		return nil, nil, 0, errors.New("failed to get members")
+	}
+
+	relations := make([]models.Relation, 0)
+	order := clause.OrderBy{Expression: clause.Expr{
+		SQL:                "owner_id = ? desc, role desc, id asc",
+		Vars:               []interface{}{group.OwnerId},
+		WithoutParentheses: true,
+	}}
+	if tx := query.Order(order).Offset((page - 1) * size).Limit(size).Find(&relations); tx.Error != nil {
+		zap.S().Info("Failed to get members")
+		return nil, nil, 0, errors.New("failed to get members")
+	}
+	return &relations, group, total, nil
+}
+
+// checkManageMember check if operator can manage the target member by permission, and return the community
+/* the operator's role should be higher than target's, so admins cannot manage the owner or other admins */
+func checkManageMember(userId uint, gid string, targetId uint, perm int) (*models.Community, error) {
+	group, err := FindGroupByGid(gid)
+	if err != nil {
+		zap.S().Info("Group is not exist")
+		return nil, gidError(err, "group is not exist")
+	}
+	role, err := models.GetMemberRole(userId, group.ID)
+	if err != nil {
+		return nil, err
+	}
+	if !models.HasPermission(role, perm) {
+		zap.S().Info("Permission denied")
+		return nil, errors.New("permission denied")
+	}
+	if userId == targetId {
+		zap.S().Info("Cannot manage yourself")
+		return nil, errors.New("cannot manage yourself")
+	}
+	targetRole, err := models.GetMemberRole(targetId, group.ID)
+	if err == nil && targetRole >= role {
+		zap.S().Info("Permission denied")
+		return nil, errors.New("permission denied: target member has higher or same role")
+	}
+	return group, nil
+}
+
+// KickMember remove a member from group, and ban him from joining in again if ban is true
+func KickMember(userId uint, gid string, targetId uint, ban bool) error {
+	group, err := checkManageMember(userId, gid, targetId, models.PermKick)
+	if err != nil {
+		return err
+	}
+	isMember := IsGroupMember(targetId, group.ID)
+	if !isMember && !ban {
+		zap.S().Info("Target user is not the member of group")
+		return errors.New("target user is not the member of group")
+	}
+
+	tx := global.DB.Begin()
+	if isMember {
+		if t := tx.Where("owner_id = ? and target_id = ? and type = 2", targetId, group.ID).Delete(&models.Relation{}); t.RowsAffected == 0 {
+			tx.Rollback()
+			zap.S().Info("Failed to delete in Table Relation")
+			return errors.New("failed to kick member")
+		}
+	}
+	if ban && !models.IsBanned(targetId, group.ID) {
+		record := models.CommunityBan{CommunityId: group.ID, UserId: targetId, OperatorId: userId}
+		if t := tx.Create(&record); t.RowsAffected == 0 {
+			tx.Rollback()
+			zap.S().Info("Failed to create in Table CommunityBan")
+			return errors.New("failed to ban member")
+		}
+	}
+	tx.Commit()
+	if isMember {
+		models.RemoveFromGroupCall(targetId, group.ID)
+	}
+	return nil
+}
+
+// UnbanMember allow the banned user to join in group again
+func UnbanMember(userId uint, gid string, targetId uint) error {
+	group, err := checkManageMember(userId, gid, targetId, models.PermKick)
+	if err != nil {
+		return err
+	}
+	if tx := global.DB.Where("community_id = ? and user_id = ?", group.ID, targetId).Delete(&models.CommunityBan{}); tx.RowsAffected == 0 {
+		zap.S().Info("User is not banned")
+		return errors.New("user is not banned")
+	}
+	return nil
+}
+
+// MuteMember forbid a member posting in group for a duration, duration 0 means unmute
+func MuteMember(userId uint, gid string, targetId uint, duration time.Duration) error {
+	group, err := checkManageMember(userId, gid, targetId, models.PermMute)
+	if err != nil {
+		return err
+	}
+	var mutedUntil *time.Time
+	if duration > 0 {
+		t := time.Now().Add(duration)
+		mutedUntil = &t
+	}
+	if !IsGroupMember(targetId, group.ID) {
+		zap.S().Info("Target user is not the member of group")
+		return errors.New("target user is not the member of group")
+	}
+	tx := global.DB.Model(&models.Relation{}).Where("owner_id = ? and target_id = ? and type = 2", targetId, group.ID).Update("muted_until", mutedUntil)
+	if tx.Error != nil {
+		zap.S().Info("Failed to mute member")
+		return errors.New("failed to mute member")
+	}
+	return nil
+}
@@ -0,0 +1,201 @@
+package dao
+
+import (
+	"HiChat/global"
+	"HiChat/models"
+	"errors"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"strings"
+)
+
+// the sort orders of friend list
+const (
+	SortFriendByName   = "name"
+	SortFriendByAlias  = "alias"
+	SortFriendByNewest = "newest"
+)
+
+// FriendQuery describes the filters and sort order of friend list
+/*
+the params are:
+	* CategoryId: only find friends in the category if it is not nil, 0 means uncategorized
+	* Tag: only find friends with the tag if it is not empty
+	* Keyword: the prefix of friend's alias or name
+	* Sort: one of SortFriendByAlias(default, by alias and then name), SortFriendByName and SortFriendByNewest
+*/
+type FriendQuery struct {
+	CategoryId *uint
+	Tag        string
+	Keyword    string
+	Sort       string
+}
+
+// FriendEntry is a friend with the private data of owner
+type FriendEntry struct {
+	ID         uint
+	PublicId   string
+	Name       string
+	Avatar     string
+	Gender     string
+	Phone      string
+	Email      string
+	Alias      string
+	Desc       string
+	CategoryId uint
+	Tags       []string `gorm:"-"`
+}
+
+// GetFriends return the friends of user filtered and sorted by query
+func GetFriends(userId uint, q FriendQuery) ([]FriendEntry, error) {
+	var order string
+	switch q.Sort {
+	case "", SortFriendByAlias:
+		order = "coalesce(nullif(relations.alias, ''), user_basics.name), user_basics.id"
+	case SortFriendByName:
+		order = "user_basics.name, user_basics.id"
+	case SortFriendByNewest:
+		order = "relations.created_at desc, user_basics.id"
+	default:
+		return nil, errors.New("invalid sort, it should be alias, name or newest")
+	}
+
+	query := global.DB.Model(&models.Relation{}).
+		Select("user_basics.id, user_basics.public_id, user_basics.name, user_basics.avatar, user_basics.gender, "+
+			"user_basics.phone, user_basics.email, relations.alias, relations.desc, relations.category_id").
+		Joins("join user_basics on user_basics.id = relations.target_id and user_basics.deleted_at is null").
+		Where("relations.owner_id = ? and relations.type = 1", userId)
+	if q.CategoryId != nil {
+		query = query.Where("relations.category_id = ?", *q.CategoryId)
+	}
+	if q.Tag != "" {
+		query = query.Where("relations.target_id in (?)",
+			global.DB.Model(&models.FriendTag{}).Select("target_id").Where("owner_id = ? and tag = ?", userId, q.Tag))
+	}
+	if q.Keyword != "" {
+		pattern := likeEscaper.Replace(q.Keyword) + "%"
+		query = query.Where("relations.alias like ? or user_basics.name like ?", pattern, pattern)
+	}
+
+	friends := make([]FriendEntry, 0)
+	if tx := query.Order(order).Scan(&friends); tx.Error != nil {
+		zap.S().Info("Failed to get friends")
+		return nil, errors.New("failed to get friend list")
+	}
+	if len(friends) == 0 {
+		return friends, nil
+	}
+
+	// fill in the tags of friends
+	friendsId := make([]uint, 0, len(friends))
+	for _, f := range friends {
+		friendsId = append(friendsId, f.ID)
+	}
+	tags := make([]models.FriendTag, 0)
+	if tx := global.DB.Where("owner_id = ? and target_id in ?", userId, friendsId).Order("id").Find(&tags); tx.Error != nil {
+		zap.S().Info("Failed to get friend tags")
+		return nil, errors.New("failed to get friend list")
+	}
+	tagsMap := make(map[uint][]string)
+	for _, t := range tags {
+		tagsMap[t.TargetId] = append(tagsMap[t.TargetId], t.Tag)
+	}
+	for i := range friends {
+		friends[i].Tags = tagsMap[friends[i].ID]
+	}
+	return friends, nil
+}
+
+// normalizeTags trim and deduplicate the tags, and check the limits
+func normalizeTags(tags []string) ([]string, error) {
+	result := make([]string, 0, len(tags))
+	seen := make(map[string]bool)
+	for _, t := range tags {
+		t = strings.TrimSpace(t)
+		if t == "" || seen[t] {
+			continue
+		}
+		if len([]rune(t)) > models.MaxTagLength {
+			return nil, errors.New("tag is too long: " + t)
+		}
+		seen[t] = true
+		result = append(result, t)
+	}
+	if len(result) > models.MaxTagsOfFriend {
+		return nil, errors.New("too many tags")
+	}
+	return result, nil
+}
+
+// setFriendTags replace the tags of friend, db should be a transaction
+func setFriendTags(db *gorm.DB, userId uint, targetId uint, tags []string) error {
+	if t := db.Where("owner_id = ? and target_id = ?", userId, targetId).Delete(&models.FriendTag{}); t.Error != nil {
+		zap.S().Info("Failed to delete friend tags")
+		return errors.New("failed to update tags")
+	}
+	for _, tag := range tags {
+		if t := db.Create(&models.FriendTag{OwnerId: userId, TargetId: targetId, Tag: tag}); t.RowsAffected == 0 {
+			zap.S().Info("Failed to create friend tag")
+			return errors.New("failed to update tags")
+		}
+	}
+	return nil
+}
+
+// CreateCategory create a contact category of user
+func CreateCategory(userId uint, name string) (*models.ContactCategory, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		zap.S().Info("Category name is empty")
+		return nil, errors.New("category name can not be empty")
+	}
+	var count int64
+	global.DB.Model(&models.ContactCategory{}).Where("owner_id = ?", userId).Count(&count)
+	if count >= models.MaxCategories {
+		zap.S().Info("Too many categories")
+		return nil, errors.New("too many categories")
+	}
+	if tx := global.DB.Where("owner_id = ? and name = ?", userId, name).First(&models.ContactCategory{}); tx.RowsAffected != 0 {
+		zap.S().Info("Category has existed")
+		return nil, errors.New("category has existed")
+	}
+	category := models.ContactCategory{OwnerId: userId, Name: name}
+	if tx := global.DB.Create(&category); tx.RowsAffected == 0 {
+		zap.S().Info("Failed to create category")
+		return nil, errors.New("failed to create category")
+	}
+	return &category, nil
+}
+
+// GetCategories return the contact categories of user
+func GetCategories(userId uint) (*[]models.ContactCategory, error) {
+	categories := make([]models.ContactCategory, 0)
+	if tx := global.DB.Where("owner_id = ?", userId).Order("id").Find(&categories); tx.Error != nil {
+		zap.S().Info("Failed to get categories")
+		return nil, errors.New("failed to get categories")
+	}
+	return &categories, nil
+}
+
+// DeleteCategory delete the contact category, the friends in it become uncategorized
+func DeleteCategory(userId uint, categoryId uint) error {
+	tx := global.DB.Begin()
+	if t := tx.Where("id = ? and owner_id = ?", categoryId, userId).Delete(&models.ContactCategory{}); t.RowsAffected == 0 {
+		tx.Rollback()
+		zap.S().Info("Category is not exist")
+		return errors.New("category is not exist")
+	}
+	if t := tx.Model(&models.Relation{}).Where("owner_id = ? and type = 1 and category_id = ?", userId, categoryId).Update("category_id", 0); t.Error != nil {
+		tx.Rollback()
+		zap.S().Info("Failed to update relations")
+		return errors.New("failed to delete category")
+	}
+	tx.Commit()
+	return nil
+}
+
+// isCategoryOwner check if the category belongs to user
+func isCategoryOwner(userId uint, categoryId uint) bool {
+	tx := global.DB.Where("id = ? and owner_id = ?", categoryId, userId).First(&models.ContactCategory{})
+	return tx.RowsAffected != 0
+}
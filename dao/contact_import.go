@@ -0,0 +1,183 @@
+package dao
+
+import (
+	"HiChat/common"
+	"HiChat/global"
+	"HiChat/models"
+	"errors"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// ContactMatch is a contact in address book which is a HiChat user
+type ContactMatch struct {
+	Hash     string
+	ID       uint
+	PublicId string
+	Name     string
+	Avatar   string
+}
+
+// ImportContacts save the hashed contacts of user and return the ones which are HiChat users
+/*
+The hashes are added to the contacts uploaded before, or replace them if replace is true.
+The matched users are filtered by their FindByPhone and FindByEmail privacy settings.
+*/
+func ImportContacts(userId uint, hashes []string, replace bool) ([]ContactMatch, error) {
+	if len(hashes) > models.MaxContactImport {
+		zap.S().Info("Too many contacts")
+		return nil, errors.New("too many contacts in one upload")
+	}
+	seen := make(map[string]bool)
+	uploaded := make([]string, 0, len(hashes))
+	for _, h := range hashes {
+		if !common.IsContactHash(h) {
+			zap.S().Info("Invalid contact hash")
+			return nil, errors.New("invalid contact hash: " + h)
+		}
+		if !seen[h] {
+			seen[h] = true
+			uploaded = append(uploaded, h)
+		}
+	}
+
+	tx := global.DB.Begin()
+	if replace {
+		if t := tx.Where("owner_id = ?", userId).Delete(&models.ContactHash{}); t.Error != nil {
+			tx.Rollback()
+			zap.S().Info("Failed to clear contacts")
+			return nil, errors.New("failed to import contacts")
+		}
+	}
+	existed := make([]string, 0)
+	if len(uploaded) > 0 {
+		tx.Model(&models.ContactHash{}).Where("owner_id = ? and hash in ?", userId, uploaded).Pluck("hash", &existed)
+	}
+	existedSet := make(map[string]bool)
+	for _, h := range existed {
+		existedSet[h] = true
+	}
+	added := make([]models.ContactHash, 0)
+	for _, h := range uploaded {
+		if !existedSet[h] {
+			added = append(added, models.ContactHash{OwnerId: userId, Hash: h})
+		}
+	}
+	var count int64
+	tx.Model(&models.ContactHash{}).Where("owner_id = ?", userId).Count(&count)
+	if count+int64(len(added)) > models.MaxContactsOfUser {
+		tx.Rollback()
+		zap.S().Info("Too many contacts")
+		return nil, errors.New("too many contacts")
+	}
+	if len(added) > 0 {
+		if t := tx.CreateInBatches(&added, 500); t.Error != nil {
+			tx.Rollback()
+			zap.S().Info("Failed to save contacts")
+			return nil, errors.New("failed to import contacts")
+		}
+	}
+	tx.Commit()
+
+	return matchContacts(userId, uploaded)
+}
+
+// matchContacts find the users with the hashed phones or emails, who can be found by the viewer
+func matchContacts(viewerId uint, hashes []string) ([]ContactMatch, error) {
+	matches := make([]ContactMatch, 0)
+	if len(hashes) == 0 {
+		return matches, nil
+	}
+	users := make([]models.UserBasic, 0)
+	tx := global.DB.Where("(phone_hash in ? or email_hash in ?) and id <> ?", hashes, hashes, viewerId).Find(&users)
+	if tx.Error != nil {
+		zap.S().Info("Failed to match contacts")
+		return nil, errors.New("failed to match contacts")
+	}
+
+	hashSet := make(map[string]bool, len(hashes))
+	for _, h := range hashes {
+		hashSet[h] = true
+	}
+	usersId := make([]uint, 0, len(users))
+	for _, u := range users {
+		usersId = append(usersId, u.ID)
+	}
+	// the privacy settings, friends and blocks are loaded once for all matched users
+	view := models.NewPrivacyView(viewerId, usersId)
+	matchedHashes := make([]string, 0)
+	matchedCase := "case hash"
+	matchedArgs := make([]interface{}, 0)
+	for _, u := range users {
+		// the avatar is blanked as in the profile, if it is hidden from the viewer
+		avatar := view.Hide(u).Avatar
+		for _, c := range []struct {
+			hash  string
+			field func(s models.PrivacySetting) int
+		}{
+			{u.PhoneHash, func(s models.PrivacySetting) int { return s.FindByPhone }},
+			{u.EmailHash, func(s models.PrivacySetting) int { return s.FindByEmail }},
+		} {
+			if c.hash != "" && hashSet[c.hash] && view.CanSee(u.ID, c.field) {
+				matches = append(matches, ContactMatch{Hash: c.hash, ID: u.ID, PublicId: u.PublicId, Name: u.Name, Avatar: avatar})
+				matchedHashes = append(matchedHashes, c.hash)
+				matchedCase += " when ? then ?"
+				matchedArgs = append(matchedArgs, c.hash, u.ID)
+			}
+		}
+	}
+
+	// the matched users of all hashes are saved by one update
+	if len(matchedHashes) > 0 {
+		tx = global.DB.Model(&models.ContactHash{}).Where("owner_id = ? and hash in ?", viewerId, matchedHashes).
+			Update("matched_id", gorm.Expr(matchedCase+" end", matchedArgs...))
+		if tx.Error != nil {
+			zap.S().Info("Failed to save matched contacts")
+		}
+	}
+	return matches, nil
+}
+
+// ClearContacts remove all the hashed contacts of user
+func ClearContacts(userId uint) error {
+	if tx := global.DB.Where("owner_id = ?", userId).Delete(&models.ContactHash{}); tx.Error != nil {
+		zap.S().Info("Failed to clear contacts")
+		return errors.New("failed to clear contacts")
+	}
+	return nil
+}
+
+// notifyContactJoined tell the owners who have the phone or email of user in address book, the owners notified before are skipped
+/* it is called when a user sets phone or email, so the contacts uploaded before are matched incrementally */
+func notifyContactJoined(user *models.UserBasic) {
+	setting := models.GetPrivacySetting(user.ID)
+	for _, c := range []struct {
+		hash       string
+		visibility int
+	}{{user.PhoneHash, setting.FindByPhone}, {user.EmailHash, setting.FindByEmail}} {
+		if c.hash == "" {
+			continue
+		}
+		contacts := make([]models.ContactHash, 0)
+		global.DB.Where("hash = ? and matched_id <> ? and owner_id <> ?", c.hash, user.ID, user.ID).Find(&contacts)
+		for _, contact := range contacts {
+			if !models.CanSee(contact.OwnerId, user.ID, c.visibility) {
+				continue
+			}
+			match := ContactMatch{Hash: c.hash, ID: user.ID, PublicId: user.PublicId, Name: user.Name, Avatar: user.Avatar}
+			if !models.CanSee(contact.OwnerId, user.ID, setting.ShowAvatar) {
+				match.Avatar = ""
+			}
+			// the offline owner is notified next time, and gets the match when importing again
+			delivered := models.SendNotification(contact.OwnerId, models.Notification{
+				Event:    models.EventContactJoined,
+				FromId:   user.ID,
+				TargetId: contact.OwnerId,
+				Data:     match,
+			})
+			if delivered {
+				global.DB.Model(&contact).Update("matched_id", user.ID)
+			}
+		}
+	}
+}
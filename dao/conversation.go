@@ -0,0 +1,159 @@
+package dao
+
+import (
+	"HiChat/global"
+	"HiChat/models"
+	"errors"
+	"go.uber.org/zap"
+	"sort"
+	"time"
+)
+
+// ConversationView is a friend chat or group chat in the conversation list, with the setting of owner
+type ConversationView struct {
+	Type       int
+	TargetId   uint
+	Name       string
+	Avatar     string
+	Muted      bool
+	MutedUntil *time.Time
+	PinnedAt   *time.Time
+	Archived   bool
+	Unread     int64
+	ActiveAt   *time.Time
+}
+
+// ConversationUpdate the changes of conversation setting, nil means not changed
+/* Mute 0 means unmute, and negative means mute forever */
+type ConversationUpdate struct {
+	Mute    *time.Duration
+	Pin     *bool
+	Archive *bool
+}
+
+// GetConversations return the friend chats and group chats of user, the archived ones or the others
+/* the pinned conversations are the first by pinned time, and the others are sorted by active time */
+func GetConversations(userId uint, archived bool) ([]ConversationView, error) {
+	conversations := make([]ConversationView, 0)
+	tx := global.DB.Model(&models.Relation{}).
+		Select("1 as type, user_basics.id as target_id, coalesce(nullif(relations.alias, ''), user_basics.name) as name, user_basics.avatar").
+		Joins("join user_basics on user_basics.id = relations.target_id and user_basics.deleted_at is null").
+		Where("relations.owner_id = ? and relations.type = 1", userId).
+		Scan(&conversations)
+	if tx.Error != nil {
+		zap.S().Info("Failed to get friend chats")
+		return nil, errors.New("failed to get conversations")
+	}
+	groups := make([]ConversationView, 0)
+	tx = global.DB.Model(&models.Relation{}).
+		Select("2 as type, communities.id as target_id, communities.name, communities.image as avatar, communities.active_at").
+		Joins("join communities on communities.id = relations.target_id and communities.deleted_at is null").
+		Where("relations.owner_id = ? and relations.type = 2", userId).
+		Scan(&groups)
+	if tx.Error != nil {
+		zap.S().Info("Failed to get group chats")
+		return nil, errors.New("failed to get conversations")
+	}
+	conversations = append(conversations, groups...)
+
+	settings := make([]models.ConversationSetting, 0)
+	if tx = global.DB.Where("owner_id = ?", userId).Find(&settings); tx.Error != nil {
+		zap.S().Info("Failed to get conversation settings")
+		return nil, errors.New("failed to get conversations")
+	}
+	settingsMap := make(map[string]models.ConversationSetting, len(settings))
+	for _, s := range settings {
+		settingsMap[models.ConversationField(s.Type, s.TargetId)] = s
+	}
+	fields := make([]string, 0, len(conversations))
+	for _, c := range conversations {
+		fields = append(fields, models.ConversationField(c.Type, c.TargetId))
+	}
+	unread, activeAt := models.ConversationActivity(userId, fields)
+
+	now := time.Now()
+	result := make([]ConversationView, 0, len(conversations))
+	for i, c := range conversations {
+		s := settingsMap[fields[i]]
+		if s.Archived != archived {
+			continue
+		}
+		if s.IsMuted(now) {
+			c.Muted, c.MutedUntil = true, s.MutedUntil
+		}
+		c.PinnedAt = s.PinnedAt
+		c.Archived = s.Archived
+		c.Unread = unread[fields[i]]
+		if t, ok := activeAt[fields[i]]; ok {
+			c.ActiveAt = &t
+		}
+		result = append(result, c)
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		a, b := result[i], result[j]
+		if (a.PinnedAt != nil) != (b.PinnedAt != nil) {
+			return a.PinnedAt != nil
+		}
+		if a.PinnedAt != nil {
+			return a.PinnedAt.After(*b.PinnedAt)
+		}
+		if (a.ActiveAt != nil) != (b.ActiveAt != nil) {
+			return a.ActiveAt != nil
+		}
+		return a.ActiveAt != nil && a.ActiveAt.After(*b.ActiveAt)
+	})
+	return result, nil
+}
+
+// UpdateConversationSetting mute, pin or archive a friend chat or group chat of user
+func UpdateConversationSetting(userId uint, chatType int, targetId uint, u ConversationUpdate) (*models.ConversationSetting, error) {
+	switch chatType {
+	case 1:
+		if GetRelationId(userId, targetId) == 0 {
+			return nil, errors.New("target User is not your friend")
+		}
+	case 2:
+		if !IsGroupMember(userId, targetId) {
+			zap.S().Info("User is not a member of group")
+			return nil, errors.New("you are not a member of the group")
+		}
+	default:
+		return nil, errors.New("invalid type, it should be 1(friend) or 2(group)")
+	}
+
+	setting := models.ConversationSetting{}
+	tx := global.DB.Where(models.ConversationSetting{OwnerId: userId, TargetId: targetId, Type: chatType}).FirstOrCreate(&setting)
+	if tx.Error != nil {
+		zap.S().Info("Failed to create conversation setting")
+		return nil, errors.New("failed to update conversation setting")
+	}
+	now := time.Now()
+	if u.Mute != nil {
+		setting.Muted = *u.Mute != 0
+		setting.MutedUntil = nil
+		if *u.Mute > 0 {
+			t := now.Add(*u.Mute)
+			setting.MutedUntil = &t
+		}
+	}
+	if u.Pin != nil && *u.Pin != (setting.PinnedAt != nil) {
+		setting.PinnedAt = nil
+		if *u.Pin {
+			var pinned int64
+			global.DB.Model(&models.ConversationSetting{}).Where("owner_id = ? and pinned_at is not null", userId).Count(&pinned)
+			if pinned >= models.MaxPinnedConversations {
+				zap.S().Info("Too many pinned conversations")
+				return nil, errors.New("too many pinned conversations")
+			}
+			setting.PinnedAt = &now
+		}
+	}
+	if u.Archive != nil {
+		setting.Archived = *u.Archive
+	}
+	if tx = global.DB.Save(&setting); tx.Error != nil {
+		zap.S().Info("Failed to update conversation setting")
+		return nil, errors.New("failed to update conversation setting")
+	}
+	return &setting, nil
+}
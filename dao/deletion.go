@@ -0,0 +1,225 @@
+package dao
+
+import (
+	"HiChat/global"
+	"HiChat/models"
+	"errors"
+	"go.uber.org/zap"
+	"time"
+)
+
+// deleteGroup soft delete the group with its members and channels in a transaction, then notify the members
+func deleteGroup(userId uint, group *models.Community, policy int) error {
+	if policy != models.HistoryArchive && policy != models.HistoryPurge {
+		zap.S().Info("Invalid history policy")
+		return errors.New("invalid history policy")
+	}
+	membersId, err := models.FindMembersId(group.ID)
+	if err != nil {
+		zap.S().Info("Failed to Get Members Id")
+		return errors.New("failed to delete")
+	}
+	channelsId := make([]uint, 0)
+	global.DB.Model(&models.GroupChannel{}).Where("community_id = ?", group.ID).Pluck("id", &channelsId)
+
+	// the same deleted_at is written, so the rows deleted together can be restored together
+	now := time.Now().Truncate(time.Second)
+	deletion := models.GroupDeletion{
+		CommunityId:   group.ID,
+		OperatorId:    userId,
+		HistoryPolicy: policy,
+		DeletedTime:   now,
+		ExpiredAt:     now.Add(models.GroupRestoreGrace),
+	}
+	tx := global.DB.Begin()
+	if t := tx.Model(group).UpdateColumn("deleted_at", now); t.RowsAffected == 0 {
+		tx.Rollback()
+		zap.S().Info("Failed to delete in Table Community")
+		return errors.New("failed to delete")
+	}
+	if t := tx.Model(&models.Relation{}).Where("target_id = ? and type = 2", group.ID).UpdateColumn("deleted_at", now); t.Error != nil {
+		tx.Rollback()
+		zap.S().Info("Failed to delete in Table Relation")
+		return errors.New("failed to delete")
+	}
+	if t := tx.Model(&models.GroupChannel{}).Where("community_id = ?", group.ID).UpdateColumn("deleted_at", now); t.Error != nil {
+		tx.Rollback()
+		zap.S().Info("Failed to delete in Table GroupChannel")
+		return errors.New("failed to delete")
+	}
+	if t := tx.Model(&models.OwnershipTransfer{}).Where("community_id = ? and status = ?", group.ID, models.TransferPending).Update("status", models.TransferCancelled); t.Error != nil {
+		tx.Rollback()
+		zap.S().Info("Failed to cancel pending transfer")
+		return errors.New("failed to delete")
+	}
+	if t := tx.Create(&deletion); t.RowsAffected == 0 {
+		tx.Rollback()
+		zap.S().Info("Failed to create deletion record")
+		return errors.New("failed to delete")
+	}
+	log := models.GroupAuditLog{CommunityId: group.ID, OperatorId: userId, Action: models.AuditGroupDelete}
+	if err = models.WriteAuditLog(tx, log); err != nil {
+		tx.Rollback()
+		return errors.New("failed to delete")
+	}
+	tx.Commit()
+
+	if policy == models.HistoryPurge {
+		models.PurgeGroupHistory(group.ID, *membersId, channelsId)
+	}
+	for _, id := range *membersId {
+		if id != userId {
+			models.SendNotification(id, models.Notification{
+				Event:    models.EventGroupDeleted,
+				FromId:   userId,
+				TargetId: group.ID,
+				Data:     group,
+			})
+		}
+	}
+	return nil
+}
+
+// GetDeletedGroups return the deleted groups of owner which can still be restored
+func GetDeletedGroups(userId uint) (*[]models.GroupDeletion, error) {
+	deletions := make([]models.GroupDeletion, 0)
+	tx := global.DB.Where("operator_id = ? and restored = ? and expired_at > ?", userId, false, time.Now()).
+		Order("id desc").Find(&deletions)
+	if tx.Error != nil {
+		zap.S().Info("Failed to get deleted groups")
+		return nil, errors.New("failed to get deleted groups")
+	}
+	return &deletions, nil
+}
+
+// RestoreGroup restore the deleted group with the members and channels deleted together, only in grace period
+func RestoreGroup(userId uint, gid string) (*models.Community, error) {
+	found, err := findGroupByGid(global.DB.Unscoped().Where("deleted_at is not null"), gid)
+	if err != nil {
+		zap.S().Info("Deleted group is not exist")
+		return nil, gidError(err, "deleted group is not exist")
+	}
+	group := *found
+	if group.OwnerId != userId {
+		zap.S().Info("Only group owner can restore group")
+		return nil, errors.New("only group owner can restore group")
+	}
+	deletion := models.GroupDeletion{}
+	tx := global.DB.Where("community_id = ? and restored = ?", group.ID, false).Order("id desc").First(&deletion)
+	if tx.RowsAffected == 0 || deletion.ExpiredAt.Before(time.Now()) {
+		zap.S().Info("Group can not be restored")
+		return nil, errors.New("the grace period of restoring has passed")
+	}
+	if t := global.DB.Where("name = ? and owner_id = ?", group.Name, group.OwnerId).First(&models.Community{}); t.RowsAffected != 0 {
+		zap.S().Info("Group with same name exists")
+		return nil, errors.New("cannot restore the group which has same Name with another group")
+	}
+
+	tx = global.DB.Begin()
+	if t := tx.Unscoped().Model(&group).UpdateColumn("deleted_at", nil); t.RowsAffected == 0 {
+		tx.Rollback()
+		zap.S().Info("Failed to restore in Table Community")
+		return nil, errors.New("failed to restore")
+	}
+	if t := tx.Unscoped().Model(&models.Relation{}).Where("target_id = ? and type = 2 and deleted_at = ?", group.ID, deletion.DeletedTime).UpdateColumn("deleted_at", nil); t.Error != nil {
+		tx.Rollback()
+		zap.S().Info("Failed to restore in Table Relation")
+		return nil, errors.New("failed to restore")
+	}
+	if t := tx.Unscoped().Model(&models.GroupChannel{}).Where("community_id = ? and deleted_at = ?", group.ID, deletion.DeletedTime).UpdateColumn("deleted_at", nil); t.Error != nil {
+		tx.Rollback()
+		zap.S().Info("Failed to restore in Table GroupChannel")
+		return nil, errors.New("failed to restore")
+	}
+	if t := tx.Model(&deletion).Update("restored", true); t.RowsAffected == 0 {
+		tx.Rollback()
+		zap.S().Info("Failed to update deletion record")
+		return nil, errors.New("failed to restore")
+	}
+	log := models.GroupAuditLog{CommunityId: group.ID, OperatorId: userId, Action: models.AuditGroupRestore}
+	if err := models.WriteAuditLog(tx, log); err != nil {
+		tx.Rollback()
+		return nil, errors.New("failed to restore")
+	}
+	tx.Commit()
+
+	group.DeletedAt.Valid = false
+	if membersId, err := models.FindMembersId(group.ID); err == nil {
+		for _, id := range *membersId {
+			if id != userId {
+				models.SendNotification(id, models.Notification{
+					Event:    models.EventGroupRestored,
+					FromId:   userId,
+					TargetId: group.ID,
+					Data:     group,
+				})
+			}
+		}
+	}
+	return &group, nil
+}
+
+// groupExpirySweepTick how often the expired group deletions are swept
+const groupExpirySweepTick = time.Hour
+
+// groupExpirySweepBatch how many expired group deletions are swept in one tick
+const groupExpirySweepBatch = 100
+
+// RunGroupExpirySweeper remove the deleted groups which cannot be restored any more in background, it never returns
+/*
+The archived history in Redis is purged after the grace period, and the soft deleted community, members and
+channels are deleted permanently, whatever the history policy is.
+*/
+func RunGroupExpirySweeper() {
+	ticker := time.NewTicker(groupExpirySweepTick)
+	defer ticker.Stop()
+	for range ticker.C {
+		deletions := make([]models.GroupDeletion, 0)
+		tx := global.DB.Where("restored = ? and purged = ? and expired_at <= ?", false, false, time.Now()).
+			Order("id").Limit(groupExpirySweepBatch).Find(&deletions)
+		if tx.Error != nil {
+			zap.S().Info("Failed to get expired deletions")
+			continue
+		}
+		for i := range deletions {
+			purgeExpiredGroup(&deletions[i])
+		}
+	}
+}
+
+// purgeExpiredGroup remove the history and the soft deleted rows of an expired group deletion
+func purgeExpiredGroup(deletion *models.GroupDeletion) {
+	// the rows deleted together with the group have the same deleted_at
+	membersId := make([]uint, 0)
+	global.DB.Unscoped().Model(&models.Relation{}).Where("target_id = ? and type = 2 and deleted_at = ?", deletion.CommunityId, deletion.DeletedTime).
+		Pluck("owner_id", &membersId)
+	channelsId := make([]uint, 0)
+	global.DB.Unscoped().Model(&models.GroupChannel{}).Where("community_id = ? and deleted_at = ?", deletion.CommunityId, deletion.DeletedTime).
+		Pluck("id", &channelsId)
+	if deletion.HistoryPolicy == models.HistoryArchive {
+		models.PurgeGroupHistory(deletion.CommunityId, membersId, channelsId)
+	}
+
+	tx := global.DB.Begin()
+	if t := tx.Unscoped().Where("target_id = ? and type = 2 and deleted_at = ?", deletion.CommunityId, deletion.DeletedTime).Delete(&models.Relation{}); t.Error != nil {
+		tx.Rollback()
+		zap.S().Info("Failed to purge in Table Relation")
+		return
+	}
+	if t := tx.Unscoped().Where("community_id = ? and deleted_at = ?", deletion.CommunityId, deletion.DeletedTime).Delete(&models.GroupChannel{}); t.Error != nil {
+		tx.Rollback()
+		zap.S().Info("Failed to purge in Table GroupChannel")
+		return
+	}
+	if t := tx.Unscoped().Where("id = ? and deleted_at is not null", deletion.CommunityId).Delete(&models.Community{}); t.Error != nil {
+		tx.Rollback()
+		zap.S().Info("Failed to purge in Table Community")
+		return
+	}
+	if t := tx.Model(deletion).Update("purged", true); t.RowsAffected == 0 {
+		tx.Rollback()
+		zap.S().Info("Failed to update deletion record")
+		return
+	}
+	tx.Commit()
+}
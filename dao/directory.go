@@ -0,0 +1,146 @@
+package dao
+
+import (
+	"HiChat/global"
+	"HiChat/models"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"go.uber.org/zap"
+	"strings"
+	"time"
+)
+
+// the sort orders of group directory
+const (
+	SortByMembers  = "members"
+	SortByActivity = "activity"
+	SortByNewest   = "newest"
+)
+
+// DirectoryQuery describes a search in public group directory
+/*
+the params are:
+	* Keyword: the keyword of group name, empty means all groups
+	* Fuzzy: match the characters of keyword in order (e.g. "hc" matches "HiChat"), otherwise match by prefix
+	* Type: only find groups of the type if it is not nil
+	* Sort: one of SortByMembers, SortByActivity and SortByNewest
+	* Cursor: the cursor returned by last page, empty means the first page
+	* Size: the size of page
+*/
+type DirectoryQuery struct {
+	Keyword string
+	Fuzzy   bool
+	Type    *int
+	Sort    string
+	Cursor  string
+	Size    int
+}
+
+// DirectoryEntry is a group listed in public group directory
+type DirectoryEntry struct {
+	ID          uint
+	GroupId     string
+	Name        string
+	Type        int
+	Image       string
+	Desc        string
+	JoinPolicy  int
+	MemberCount int64
+	ActiveAt    *time.Time
+	SortValue   int64 `json:"-"`
+}
+
+// the member count of every group in directory
+const memberCountExpr = "(select count(*) from relations r where r.target_id = communities.id and r.type = 2 and r.deleted_at is null)"
+
+// likeEscaper escape the wildcard characters of LIKE
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// SearchGroupDirectory search public groups, and return a page of groups and the cursor of next page ("" if no more)
+func SearchGroupDirectory(q DirectoryQuery) ([]DirectoryEntry, string, error) {
+	// the sort value of every group, groups are sorted by it desc and then by id asc
+	var sortExpr string
+	switch q.Sort {
+	case "", SortByMembers:
+		sortExpr = memberCountExpr
+	case SortByActivity:
+		sortExpr = "coalesce(unix_timestamp(communities.active_at), 0)"
+	case SortByNewest:
+		sortExpr = "unix_timestamp(communities.created_at)"
+	default:
+		return nil, "", errors.New("invalid sort, it should be members, activity or newest")
+	}
+
+	inner := global.DB.Model(&models.Community{}).
+		Select("communities.*, "+memberCountExpr+" as member_count, "+sortExpr+" as sort_value").
+		Where("is_public = ?", true)
+	if q.Keyword != "" {
+		pattern := likeEscaper.Replace(q.Keyword) + "%"
+		if q.Fuzzy {
+			chars := make([]string, 0)
+			for _, c := range q.Keyword {
+				chars = append(chars, likeEscaper.Replace(string(c)))
+			}
+			pattern = "%" + strings.Join(chars, "%") + "%"
+		}
+		inner = inner.Where("name like ?", pattern)
+	}
+	if q.Type != nil {
+		inner = inner.Where("type = ?", *q.Type)
+	}
+
+	query := global.DB.Table("(?) as t", inner)
+	if q.Cursor != "" {
+		value, id, err := decodeCursor(q.Cursor)
+		if err != nil {
+			return nil, "", err
+		}
+		query = query.Where("sort_value < ? or (sort_value = ? and id > ?)", value, value, id)
+	}
+
+	entries := make([]DirectoryEntry, 0)
+	if tx := query.Order("sort_value desc, id asc").Limit(q.Size + 1).Find(&entries); tx.Error != nil {
+		zap.S().Info("Failed to search group directory: ", tx.Error)
+		return nil, "", errors.New("failed to search group directory")
+	}
+
+	// we have taken one more record to know if there is next page
+	next := ""
+	if len(entries) > q.Size {
+		entries = entries[:q.Size]
+		last := entries[len(entries)-1]
+		next = encodeCursor(last.SortValue, last.ID)
+	}
+	return entries, next, nil
+}
+
+// SetGroupVisibility list or unlist the group in public group directory
+func SetGroupVisibility(userId uint, gid string, isPublic bool) error {
+	group, err := checkGroupPermission(userId, gid, models.PermEditInfo)
+	if err != nil {
+		return err
+	}
+	if tx := global.DB.Model(group).Update("is_public", isPublic); tx.Error != nil {
+		zap.S().Info("Failed to update visibility")
+		return errors.New("failed to update visibility")
+	}
+	return nil
+}
+
+func encodeCursor(value int64, id uint) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("%d,%d", value, id)))
+}
+
+func decodeCursor(cursor string) (int64, uint, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, 0, errors.New("invalid cursor")
+	}
+	var value int64
+	var id uint
+	if _, err = fmt.Sscanf(string(raw), "%d,%d", &value, &id); err != nil {
+		return 0, 0, errors.New("invalid cursor")
+	}
+	return value, id, nil
+}
@@ -0,0 +1,33 @@
+package dao
+
+import (
+	"HiChat/global"
+	"HiChat/models"
+	"errors"
+	"go.uber.org/zap"
+)
+
+// SetFloodControl update the slow mode seconds, max message length and link restriction hours of group
+func SetFloodControl(userId uint, gid string, slowMode int, maxLength int, linkHours int) error {
+	if slowMode < 0 || slowMode > models.MaxSlowMode ||
+		maxLength < 0 || maxLength > models.MaxMessageTextLength ||
+		linkHours < 0 || linkHours > models.MaxLinkRestrictHours {
+		zap.S().Info("Invalid flood control params")
+		return errors.New("invalid slow mode, max length or link restriction hours")
+	}
+	group, err := checkGroupPermission(userId, gid, models.PermEditInfo)
+	if err != nil {
+		return err
+	}
+	// 0 means no limit, so the columns are updated by map
+	tx := global.DB.Model(group).Updates(map[string]interface{}{
+		"slow_mode":           slowMode,
+		"max_message_length":  maxLength,
+		"link_restrict_hours": linkHours,
+	})
+	if tx.Error != nil {
+		zap.S().Info("Failed to update flood control")
+		return errors.New("failed to update flood control")
+	}
+	return nil
+}
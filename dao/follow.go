@@ -0,0 +1,126 @@
+package dao
+
+import (
+	"HiChat/global"
+	"HiChat/models"
+	"errors"
+	"go.uber.org/zap"
+)
+
+// SetBroadcastAccount turn user into a broadcast account or update it, disabling removes the account and its followers
+func SetBroadcastAccount(userId uint, enabled bool, allowDirectMessage bool) (*models.BroadcastAccount, error) {
+	if !enabled {
+		tx := global.DB.Begin()
+		if t := tx.Where("user_id = ?", userId).Delete(&models.BroadcastAccount{}); t.RowsAffected == 0 {
+			tx.Rollback()
+			zap.S().Info("Broadcast account is not exist")
+			return nil, errors.New("account is not a broadcast account")
+		}
+		if t := tx.Where("target_id = ? and type = 4", userId).Delete(&models.Relation{}); t.Error != nil {
+			tx.Rollback()
+			zap.S().Info("Failed to remove followers")
+			return nil, errors.New("failed to disable broadcast account")
+		}
+		tx.Commit()
+		return nil, nil
+	}
+
+	account := models.BroadcastAccount{}
+	if tx := global.DB.Where(models.BroadcastAccount{UserId: userId}).FirstOrCreate(&account); tx.Error != nil {
+		zap.S().Info("Failed to create broadcast account")
+		return nil, errors.New("failed to update broadcast account")
+	}
+	if tx := global.DB.Model(&account).Update("allow_direct_message", allowDirectMessage); tx.Error != nil {
+		zap.S().Info("Failed to update broadcast account")
+		return nil, errors.New("failed to update broadcast account")
+	}
+	return &account, nil
+}
+
+// Follow let user follow the broadcast account
+func Follow(userId uint, accountId uint) error {
+	if userId == accountId {
+		zap.S().Info("userId cannot equal to accountId")
+		return errors.New("cannot follow yourself")
+	}
+	if _, err := models.FindBroadcastAccount(accountId); err != nil {
+		zap.S().Info("Target is not a broadcast account")
+		return err
+	}
+	if models.IsBlockedEither(userId, accountId) {
+		zap.S().Info("User is blocked")
+		return errors.New("cannot follow this account")
+	}
+	if models.IsFollower(userId, accountId) {
+		zap.S().Info("User has followed the account")
+		return errors.New("you have followed this account")
+	}
+	relation := models.Relation{OwnerId: userId, TargetId: accountId, Type: 4}
+	if tx := global.DB.Create(&relation); tx.RowsAffected == 0 {
+		zap.S().Info("Failed to Create Relation")
+		return errors.New("failed to follow")
+	}
+	return nil
+}
+
+// Unfollow let user stop following the broadcast account
+func Unfollow(userId uint, accountId uint) error {
+	if tx := global.DB.Where("owner_id = ? and target_id = ? and type = 4", userId, accountId).Delete(&models.Relation{}); tx.RowsAffected == 0 {
+		zap.S().Info("User didn't follow the account")
+		return errors.New("you didn't follow this account")
+	}
+	return nil
+}
+
+// GetFollowers return a page of followers of the broadcast account, the latest first, and the total number
+func GetFollowers(accountId uint, page int, size int) ([]*models.UserBasic, int64, error) {
+	if _, err := models.FindBroadcastAccount(accountId); err != nil {
+		return nil, 0, err
+	}
+	var total int64
+	query := global.DB.Model(&models.Relation{}).Where("target_id = ? and type = 4", accountId)
+	if tx := query.Count(&total); tx.Error != nil {
+		zap.S().Info("Failed to count followers")
+		return nil, 0, errors.New("failed to get followers")
+	}
+	followersId := make([]uint, 0)
+	if tx := query.Order("id desc").Offset((page-1)*size).Limit(size).Pluck("owner_id", &followersId); tx.Error != nil {
+		zap.S().Info("Failed to get followers")
+		return nil, 0, errors.New("failed to get followers")
+	}
+	users, err := GetUsersByIds(followersId)
+	if err != nil {
+		return nil, 0, err
+	}
+	// keep the order of follow time
+	usersMap := make(map[uint]*models.UserBasic, len(users))
+	for _, u := range users {
+		usersMap[u.ID] = u
+	}
+	followers := make([]*models.UserBasic, 0, len(users))
+	for _, id := range followersId {
+		if u, ok := usersMap[id]; ok {
+			followers = append(followers, u)
+		}
+	}
+	return followers, total, nil
+}
+
+// GetFollowing return the broadcast accounts followed by user
+func GetFollowing(userId uint) ([]*models.UserBasic, error) {
+	accountsId := make([]uint, 0)
+	if tx := global.DB.Model(&models.Relation{}).Where("owner_id = ? and type = 4", userId).Pluck("target_id", &accountsId); tx.Error != nil {
+		zap.S().Info("Failed to get following accounts")
+		return nil, errors.New("failed to get following accounts")
+	}
+	return GetUsersByIds(accountsId)
+}
+
+// CheckFeedAccess check if user can read the posts of account, only the followers and the account itself can
+func CheckFeedAccess(userId uint, accountId uint) error {
+	if userId == accountId || models.IsFollower(userId, accountId) {
+		return nil
+	}
+	zap.S().Info("User didn't follow the account")
+	return errors.New("you didn't follow this account")
+}
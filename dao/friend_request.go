@@ -0,0 +1,195 @@
+package dao
+
+import (
+	"HiChat/global"
+	"HiChat/models"
+	"errors"
+	"go.uber.org/zap"
+	"time"
+)
+
+// SendFriendRequestByName Find Target User Id and call SendFriendRequest
+func SendFriendRequestByName(userId uint, targetName string, greeting string) (string, error) {
+	// check if targetUser exist
+	targetUser, err := GetUserByNameForLoginIn(targetName)
+	if err != nil || targetUser.ID == 0 {
+		zap.S().Info("Target User is not exist")
+		return "", errors.New("target User is not exist")
+	}
+	return SendFriendRequest(userId, targetUser.ID, greeting)
+}
+
+// SendFriendRequestByPublicId send a friend request to the user with the user-visible id
+func SendFriendRequestByPublicId(userId uint, targetPublicId string, greeting string) (string, error) {
+	targetUser, err := GetUserByPublicId(targetPublicId)
+	if err != nil || targetUser.ID == 0 {
+		zap.S().Info("Target User is not exist")
+		return "", errors.New("target User is not exist")
+	}
+	return SendFriendRequest(userId, targetUser.ID, greeting)
+}
+
+// SendFriendRequest send a friend request with greeting and notify the recipient
+/*
+If the recipient has sent a pending request to user, that request is accepted directly.
+If user has sent a pending request before, the greeting and expiration of it are refreshed.
+Otherwise the request is checked against the FriendRequest privacy setting of recipient.
+*/
+func SendFriendRequest(userId uint, targetId uint, greeting string) (string, error) {
+	if userId == targetId {
+		zap.S().Info("userId cannot equal to targetId")
+		return "", errors.New("cannot add yourself as friends")
+	}
+
+	// check if targetId exist
+	targetUser, err := GetUserById(targetId)
+	if err != nil || targetUser.ID == 0 {
+		zap.S().Info("Target User is not exist")
+		return "", errors.New("target User is not exist")
+	}
+	if GetRelationId(userId, targetId) != 0 || GetRelationId(targetId, userId) != 0 {
+		zap.S().Info("Relation has already existed")
+		return "", errors.New("relation has already existed")
+	}
+	if models.IsBlocked(userId, targetId) {
+		zap.S().Info("Target User is blocked")
+		return "", errors.New("you have blocked this user")
+	}
+	if models.IsBlocked(targetId, userId) {
+		zap.S().Info("User is blocked by Target User")
+		return "", errors.New("cannot send friend request to this user")
+	}
+
+	now := time.Now()
+	request := models.FriendRequest{}
+	if tx := global.DB.Where("from_id = ? and to_id = ? and status = ? and expired_at > ?", targetId, userId, models.FriendRequestPending, now).
+		First(&request); tx.RowsAffected != 0 {
+		if err = RespondFriendRequest(userId, request.ID, models.FriendRequestAccepted); err != nil {
+			return "", err
+		}
+		return "Successfully add friend!", nil
+	}
+	if err = checkFriendRequestPrivacy(userId, targetId); err != nil {
+		return "", err
+	}
+
+	request = models.FriendRequest{}
+	tx := global.DB.Where("from_id = ? and to_id = ? and status = ? and expired_at > ?", userId, targetId, models.FriendRequestPending, now).First(&request)
+	if tx.RowsAffected != 0 {
+		request.Greeting = greeting
+		request.ExpiredAt = now.Add(models.FriendRequestExpiration)
+		if t := global.DB.Save(&request); t.Error != nil {
+			zap.S().Info("Failed to update friend request")
+			return "", errors.New("failed to send friend request")
+		}
+	} else {
+		request = models.FriendRequest{
+			FromId:    userId,
+			ToId:      targetId,
+			Greeting:  greeting,
+			Status:    models.FriendRequestPending,
+			ExpiredAt: now.Add(models.FriendRequestExpiration),
+		}
+		if t := global.DB.Create(&request); t.RowsAffected == 0 {
+			zap.S().Info("Failed to create friend request")
+			return "", errors.New("failed to send friend request")
+		}
+	}
+
+	models.SendNotification(targetId, models.Notification{
+		Event:    models.EventFriendRequest,
+		FromId:   userId,
+		TargetId: targetId,
+		Data:     request,
+	})
+	return "Friend request has been sent, please wait for acceptance", nil
+}
+
+// GetFriendRequests return the pending friend requests which are not expired, incoming or outgoing
+func GetFriendRequests(userId uint, incoming bool) (*[]models.FriendRequest, error) {
+	column := "from_id"
+	if incoming {
+		column = "to_id"
+	}
+	requests := make([]models.FriendRequest, 0)
+	tx := global.DB.Where(column+" = ? and status = ? and expired_at > ?", userId, models.FriendRequestPending, time.Now()).
+		Order("id desc").Find(&requests)
+	if tx.Error != nil {
+		zap.S().Info("Failed to get friend requests")
+		return nil, errors.New("failed to get friend requests")
+	}
+	return &requests, nil
+}
+
+// RespondFriendRequest accept, reject or ignore a pending friend request by the recipient
+/* the friend relation is created when accepting, and the sender is notified unless the request is ignored */
+func RespondFriendRequest(userId uint, requestId uint, status int) error {
+	if status != models.FriendRequestAccepted && status != models.FriendRequestRejected && status != models.FriendRequestIgnored {
+		zap.S().Info("Invalid friend request status")
+		return errors.New("invalid friend request status")
+	}
+	request := models.FriendRequest{}
+	if tx := global.DB.Where("id = ? and to_id = ? and status = ?", requestId, userId, models.FriendRequestPending).First(&request); tx.RowsAffected == 0 {
+		zap.S().Info("Friend request is not exist")
+		return errors.New("friend request is not exist or has been handled")
+	}
+	if request.ExpiredAt.Before(time.Now()) {
+		zap.S().Info("Friend request is expired")
+		return errors.New("friend request is expired")
+	}
+
+	tx := global.DB.Begin()
+	if t := tx.Model(&request).Where("status = ?", models.FriendRequestPending).Update("status", status); t.RowsAffected == 0 {
+		tx.Rollback()
+		zap.S().Info("Friend request has been handled")
+		return errors.New("friend request has been handled")
+	}
+	if status == models.FriendRequestAccepted {
+		if err := addFriend(tx, request.FromId, request.ToId); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	tx.Commit()
+	if status == models.FriendRequestAccepted {
+		models.InvalidateRecommendations(request.FromId, request.ToId)
+	}
+
+	event := models.EventFriendRejected
+	switch status {
+	case models.FriendRequestIgnored:
+		return nil
+	case models.FriendRequestAccepted:
+		event = models.EventFriendAccepted
+	}
+	models.SendNotification(request.FromId, models.Notification{
+		Event:    event,
+		FromId:   userId,
+		TargetId: request.FromId,
+		Data:     request,
+	})
+	return nil
+}
+
+// connectedSQL check if two users have a mutual friend or a shared group
+const connectedSQL = "select exists (select 1 from relations a join relations b on a.target_id = b.target_id and a.type = b.type " +
+	"where a.owner_id = ? and b.owner_id = ? and a.type in (1, 2) and a.deleted_at is null and b.deleted_at is null)"
+
+// checkFriendRequestPrivacy check if the user can send friend request to target by the privacy setting of target
+func checkFriendRequestPrivacy(userId uint, targetId uint) error {
+	switch models.GetPrivacySetting(targetId).FriendRequest {
+	case models.RequestFromEveryone:
+		return nil
+	case models.RequestFromConnected:
+		connected := false
+		if tx := global.DB.Raw(connectedSQL, userId, targetId).Scan(&connected); tx.Error != nil {
+			zap.S().Info("Failed to check mutual friends and groups")
+			return errors.New("failed to send friend request")
+		}
+		if connected {
+			return nil
+		}
+	}
+	zap.S().Info("Friend request is not allowed by privacy setting")
+	return errors.New("this user does not accept friend requests from you")
+}
@@ -0,0 +1,259 @@
+package dao
+
+import (
+	"HiChat/common"
+	"HiChat/global"
+	"HiChat/models"
+	"errors"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"time"
+)
+
+// SetJoinPolicy change the join policy of group
+func SetJoinPolicy(userId uint, gid string, policy int) error {
+	if policy != models.JoinOpen && policy != models.JoinByApproval && policy != models.JoinByInvite {
+		zap.S().Info("Invalid join policy")
+		return errors.New("invalid join policy")
+	}
+	group, err := checkGroupPermission(userId, gid, models.PermEditInfo)
+	if err != nil {
+		return err
+	}
+	if tx := global.DB.Model(group).Update("join_policy", policy); tx.Error != nil {
+		zap.S().Info("Failed to update join policy")
+		return errors.New("failed to update join policy")
+	}
+	return nil
+}
+
+// checkGroupPermission check if user has the permission in group, and return the community
+func checkGroupPermission(userId uint, gid string, perm int) (*models.Community, error) {
+	group, err := FindGroupByGid(gid)
+	if err != nil {
+		zap.S().Info("Group is not exist")
+		return nil, gidError(err, "group is not exist")
+	}
+	role, err := models.GetMemberRole(userId, group.ID)
+	if err != nil {
+		return nil, err
+	}
+	if !models.HasPermission(role, perm) {
+		zap.S().Info("Permission denied")
+		return nil, errors.New("permission denied")
+	}
+	return group, nil
+}
+
+// GetGroupManagersId return the userId of owner and admins of group
+func GetGroupManagersId(group *models.Community) []uint {
+	relations := make([]models.Relation, 0)
+	global.DB.Where("target_id = ? and type = 2 and role = ?", group.ID, models.RoleAdmin).Find(&relations)
+	managersId := []uint{group.OwnerId}
+	for _, r := range relations {
+		if r.OwnerId != group.OwnerId {
+			managersId = append(managersId, r.OwnerId)
+		}
+	}
+	return managersId
+}
+
+// createJoinRequest create a pending join request and notify the admins of group
+func createJoinRequest(userId uint, group *models.Community, greeting string) (string, error) {
+	request := models.JoinRequest{}
+	if tx := global.DB.Where("community_id = ? and user_id = ? and status = ?", group.ID, userId, models.JoinRequestPending).First(&request); tx.RowsAffected != 0 {
+		zap.S().Info("Join request is pending")
+		return "", errors.New("join request has been sent, please wait for approval")
+	}
+
+	request = models.JoinRequest{CommunityId: group.ID, UserId: userId, Greeting: greeting}
+	if tx := global.DB.Create(&request); tx.RowsAffected == 0 {
+		zap.S().Info("Failed to create join request")
+		return "", errors.New("failed to create join request")
+	}
+
+	for _, id := range GetGroupManagersId(group) {
+		models.SendNotification(id, models.Notification{
+			Event:    models.EventJoinRequest,
+			FromId:   userId,
+			TargetId: group.ID,
+			Data:     request,
+		})
+	}
+	return "Join request has been sent, please wait for approval", nil
+}
+
+// GetJoinRequests return the pending join requests of group, only admins can see them
+func GetJoinRequests(userId uint, gid string) (*[]models.JoinRequest, error) {
+	group, err := checkGroupPermission(userId, gid, models.PermApproveJoin)
+	if err != nil {
+		return nil, err
+	}
+	requests := make([]models.JoinRequest, 0)
+	if tx := global.DB.Where("community_id = ? and status = ?", group.ID, models.JoinRequestPending).Order("id asc").Find(&requests); tx.Error != nil {
+		zap.S().Info("Failed to get join requests")
+		return nil, errors.New("failed to get join requests")
+	}
+	return &requests, nil
+}
+
+// HandleJoinRequest approve or reject a pending join request, and notify the applicant
+func HandleJoinRequest(userId uint, requestId uint, approve bool) error {
+	request := models.JoinRequest{}
+	if tx := global.DB.Where("id = ? and status = ?", requestId, models.JoinRequestPending).First(&request); tx.RowsAffected == 0 {
+		zap.S().Info("Join request is not exist")
+		return errors.New("join request is not exist or has been handled")
+	}
+	role, err := models.GetMemberRole(userId, request.CommunityId)
+	if err != nil {
+		return err
+	}
+	if !models.HasPermission(role, models.PermApproveJoin) {
+		zap.S().Info("Permission denied")
+		return errors.New("permission denied")
+	}
+
+	status, event := models.JoinRequestRejected, models.EventJoinRejected
+	if approve {
+		status, event = models.JoinRequestApproved, models.EventJoinApproved
+	}
+
+	tx := global.DB.Begin()
+	t := tx.Model(&request).Where("status = ?", models.JoinRequestPending).Updates(map[string]interface{}{"status": status, "operator_id": userId})
+	if t.RowsAffected == 0 {
+		tx.Rollback()
+		zap.S().Info("Join request has been handled")
+		return errors.New("join request has been handled")
+	}
+	if approve {
+		if err = checkJoinIn(request.UserId, request.CommunityId); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err = addMember(tx, request.UserId, request.CommunityId); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	tx.Commit()
+
+	models.SendNotification(request.UserId, models.Notification{
+		Event:    event,
+		FromId:   userId,
+		TargetId: request.CommunityId,
+	})
+	return nil
+}
+
+// CreateInviteLink create an invite link token of group
+/* maxUses 0 means unlimited, expire 0 means never expire */
+func CreateInviteLink(userId uint, gid string, maxUses int, expire time.Duration) (*models.InviteLink, error) {
+	if maxUses < 0 || expire < 0 {
+		zap.S().Info("Invalid invite link params")
+		return nil, errors.New("invalid max uses or expire time")
+	}
+	group, err := checkGroupPermission(userId, gid, models.PermInvite)
+	if err != nil {
+		return nil, err
+	}
+	link := models.InviteLink{
+		CommunityId: group.ID,
+		CreatorId:   userId,
+		Token:       common.RandomToken(16),
+		MaxUses:     maxUses,
+	}
+	if expire > 0 {
+		t := time.Now().Add(expire)
+		link.ExpiredAt = &t
+	}
+	if tx := global.DB.Create(&link); tx.RowsAffected == 0 {
+		zap.S().Info("Failed to create invite link")
+		return nil, errors.New("failed to create invite link")
+	}
+	return &link, nil
+}
+
+// RevokeInviteLink delete the invite link, only the creator and admins can revoke it
+func RevokeInviteLink(userId uint, token string) error {
+	link := models.InviteLink{}
+	if tx := global.DB.Where("token = ?", token).First(&link); tx.RowsAffected == 0 {
+		zap.S().Info("Invite link is not exist")
+		return errors.New("invite link is not exist")
+	}
+	if link.CreatorId != userId {
+		role, err := models.GetMemberRole(userId, link.CommunityId)
+		if err != nil || !models.HasPermission(role, models.PermApproveJoin) {
+			zap.S().Info("Permission denied")
+			return errors.New("permission denied")
+		}
+	}
+	if tx := global.DB.Delete(&link); tx.RowsAffected == 0 {
+		zap.S().Info("Failed to revoke invite link")
+		return errors.New("failed to revoke invite link")
+	}
+	return nil
+}
+
+// JoinInCommunityByLink join in group directly by invite link, no matter what the join policy is
+func JoinInCommunityByLink(userId uint, token string) (*models.Community, error) {
+	link := models.InviteLink{}
+	if tx := global.DB.Where("token = ?", token).First(&link); tx.RowsAffected == 0 {
+		zap.S().Info("Invite link is not exist")
+		return nil, errors.New("invite link is invalid")
+	}
+	group := models.Community{}
+	if tx := global.DB.Where("id = ?", link.CommunityId).First(&group); tx.RowsAffected == 0 {
+		zap.S().Info("Target Community did not exist")
+		return nil, errors.New("target Community did not exist")
+	}
+	if err := checkJoinIn(userId, group.ID); err != nil {
+		return nil, err
+	}
+
+	// use the link only if it is not expired or used up, the condition is checked in one statement
+	tx := global.DB.Begin()
+	t := tx.Model(&models.InviteLink{}).
+		Where("id = ? and (max_uses = 0 or uses < max_uses) and (expired_at is null or expired_at > ?)", link.ID, time.Now()).
+		UpdateColumn("uses", gorm.Expr("uses + 1"))
+	if t.RowsAffected == 0 {
+		tx.Rollback()
+		zap.S().Info("Invite link is expired")
+		return nil, errors.New("invite link is expired or used up")
+	}
+	if err := addMember(tx, userId, group.ID); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	tx.Commit()
+	return &group, nil
+}
+
+// InviteMember add the target user into group directly, the inviter needs the invite permission
+/* the target who blocked the inviter, or who does not allow the inviter by AddToGroup setting, can not be added */
+func InviteMember(userId uint, gid string, targetId uint) (*models.Community, error) {
+	group, err := checkGroupPermission(userId, gid, models.PermInvite)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = GetUserById(targetId); err != nil {
+		zap.S().Info("Target User is not exist")
+		return nil, errors.New("target User is not exist")
+	}
+	if !models.CanSee(userId, targetId, models.GetPrivacySetting(targetId).AddToGroup) {
+		zap.S().Info("Invitation is not allowed by privacy setting")
+		return nil, errors.New("this user can not be added to groups by you")
+	}
+	if err = checkJoinIn(targetId, group.ID); err != nil {
+		return nil, err
+	}
+	if err = addMember(global.DB, targetId, group.ID); err != nil {
+		return nil, err
+	}
+	models.SendNotification(targetId, models.Notification{
+		Event:    models.EventGroupInvited,
+		FromId:   userId,
+		TargetId: group.ID,
+		Data:     group,
+	})
+	return group, nil
+}
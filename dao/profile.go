@@ -0,0 +1,107 @@
+package dao
+
+import (
+	"HiChat/global"
+	"HiChat/models"
+	"errors"
+	"go.uber.org/zap"
+	"time"
+)
+
+// MaxProfileBatch the max number of users looked up in one profile request
+const MaxProfileBatch = 100
+
+// RelationContext is the relationship between the viewer and another user
+/*
+the params are:
+	* IsFriend: if they are friends
+	* RequestSent, RequestReceived: if there is a pending friend request from or to the viewer
+	* Blocking: if the viewer has blocked the user
+	* BlockedBy: if the user has blocked the viewer
+	* MutualFriends, SharedGroups: the number of common friends and groups
+*/
+type RelationContext struct {
+	IsFriend        bool
+	RequestSent     bool
+	RequestReceived bool
+	Blocking        bool
+	BlockedBy       bool
+	MutualFriends   int
+	SharedGroups    int
+}
+
+// commonRelationsSQL count the common friends(type 1) and groups(type 2) of the viewer with every user
+const commonRelationsSQL = "select b.owner_id as user_id, a.type, count(*) as total from relations a " +
+	"join relations b on b.target_id = a.target_id and b.type = a.type " +
+	"where a.owner_id = ? and a.type in (1, 2) and b.owner_id in ? and a.deleted_at is null and b.deleted_at is null " +
+	"group by b.owner_id, a.type"
+
+// GetRelationContexts return the relationship between the viewer and every user, the key is user id
+/* the relationship is computed by a fixed number of queries, no matter how many users are looked up */
+func GetRelationContexts(viewerId uint, usersId []uint) (map[uint]*RelationContext, error) {
+	if len(usersId) > MaxProfileBatch {
+		return nil, errors.New("too many users in one lookup")
+	}
+	contexts := make(map[uint]*RelationContext, len(usersId))
+	for _, id := range usersId {
+		contexts[id] = &RelationContext{}
+	}
+	if len(usersId) == 0 {
+		return contexts, nil
+	}
+
+	// the friend and block relations between the viewer and users, in both directions
+	relations := make([]models.Relation, 0)
+	tx := global.DB.Where("type in (1, 3) and ((owner_id = ? and target_id in ?) or (target_id = ? and owner_id in ?))",
+		viewerId, usersId, viewerId, usersId).Find(&relations)
+	if tx.Error != nil {
+		zap.S().Info("Failed to get relations")
+		return nil, errors.New("failed to get relationship")
+	}
+	for _, r := range relations {
+		switch {
+		case r.Type == 1 && r.OwnerId == viewerId:
+			contexts[r.TargetId].IsFriend = true
+		case r.Type == 3 && r.OwnerId == viewerId:
+			contexts[r.TargetId].Blocking = true
+		case r.Type == 3:
+			contexts[r.OwnerId].BlockedBy = true
+		}
+	}
+
+	requests := make([]models.FriendRequest, 0)
+	tx = global.DB.Where("status = ? and expired_at > ? and ((from_id = ? and to_id in ?) or (to_id = ? and from_id in ?))",
+		models.FriendRequestPending, time.Now(), viewerId, usersId, viewerId, usersId).Find(&requests)
+	if tx.Error != nil {
+		zap.S().Info("Failed to get friend requests")
+		return nil, errors.New("failed to get relationship")
+	}
+	for _, r := range requests {
+		if r.FromId == viewerId {
+			contexts[r.ToId].RequestSent = true
+		} else {
+			contexts[r.FromId].RequestReceived = true
+		}
+	}
+
+	counts := make([]struct {
+		UserId uint
+		Type   int
+		Total  int
+	}, 0)
+	if tx = global.DB.Raw(commonRelationsSQL, viewerId, usersId).Scan(&counts); tx.Error != nil {
+		zap.S().Info("Failed to count mutual friends and shared groups")
+		return nil, errors.New("failed to get relationship")
+	}
+	for _, c := range counts {
+		if c.UserId == viewerId {
+			continue
+		}
+		if c.Type == 1 {
+			contexts[c.UserId].MutualFriends = c.Total
+		} else {
+			contexts[c.UserId].SharedGroups = c.Total
+		}
+	}
+	return contexts, nil
+}
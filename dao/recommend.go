@@ -0,0 +1,85 @@
+package dao
+
+import (
+	"HiChat/global"
+	"HiChat/models"
+	"errors"
+	"go.uber.org/zap"
+	"time"
+)
+
+// the candidates are the friends of friends and the members of shared groups (broadcast channels are not counted),
+// excluding the user himself, his friends, the deleted users and the users blocked by either side
+const recommendSQL = `
+select c.id as user_id, sum(c.mutual) as mutual_friends, sum(c.shared) as shared_groups from (
+	select f2.target_id as id, 1 as mutual, 0 as shared from relations f1
+	join relations f2 on f2.owner_id = f1.target_id and f2.type = 1 and f2.deleted_at is null
+	where f1.owner_id = @user and f1.type = 1 and f1.deleted_at is null
+	union all
+	select g2.owner_id as id, 0 as mutual, 1 as shared from relations g1
+	join communities on communities.id = g1.target_id and communities.type <> @channel and communities.deleted_at is null
+	join relations g2 on g2.target_id = g1.target_id and g2.type = 2 and g2.deleted_at is null
+	where g1.owner_id = @user and g1.type = 2 and g1.deleted_at is null
+) c
+join user_basics on user_basics.id = c.id and user_basics.deleted_at is null
+where c.id <> @user
+and not exists (select 1 from relations r where r.owner_id = @user and r.target_id = c.id and r.type = 1 and r.deleted_at is null)
+and not exists (select 1 from relations b where b.type = 3 and b.deleted_at is null and
+	((b.owner_id = @user and b.target_id = c.id) or (b.owner_id = c.id and b.target_id = @user)))
+group by c.id
+order by sum(c.mutual) * 3 + sum(c.shared) desc, c.id
+limit @limit`
+
+// how often the refresher takes the users waiting for refresh
+const recommendRefresherTick = 5 * time.Second
+
+// computeRecommendations rank the people the user may know by mutual friends and shared groups
+func computeRecommendations(userId uint) ([]models.Recommendation, error) {
+	recommendations := make([]models.Recommendation, 0)
+	tx := global.DB.Raw(recommendSQL, map[string]interface{}{
+		"user":    userId,
+		"channel": models.GroupTypeChannel,
+		"limit":   models.MaxRecommendations,
+	}).Scan(&recommendations)
+	if tx.Error != nil {
+		zap.S().Info("Failed to compute recommendations")
+		return nil, errors.New("failed to compute recommendations")
+	}
+	for i := range recommendations {
+		recommendations[i].Score = models.RecommendScore(recommendations[i].MutualFriends, recommendations[i].SharedGroups)
+	}
+	return recommendations, nil
+}
+
+// GetRecommendations return a page of people the user may know and the total number
+/*
+the recommendations are served from the cached store, the stale ones are still served and computed again by
+RunRecommendRefresher, so the request never waits for computing. The first request of user may get an empty page.
+*/
+func GetRecommendations(userId uint, page int, size int) ([]models.Recommendation, int64, error) {
+	if !models.IsRecommendationFresh(userId) {
+		models.RequestRecommendRefresh(userId)
+	}
+	recommendations, total, err := models.GetRecommendations(userId, int64((page-1)*size), int64(size))
+	if err != nil {
+		return nil, 0, errors.New("failed to get recommendations")
+	}
+	return recommendations, total, nil
+}
+
+// RunRecommendRefresher compute the recommendations of the users waiting for refresh in background, it never returns
+func RunRecommendRefresher() {
+	ticker := time.NewTicker(recommendRefresherTick)
+	defer ticker.Stop()
+	for range ticker.C {
+		for _, userId := range models.PopRecommendRefresh() {
+			recommendations, err := computeRecommendations(userId)
+			if err != nil {
+				continue
+			}
+			if err = models.SaveRecommendations(userId, recommendations); err != nil {
+				zap.S().Info("Failed to save recommendations")
+			}
+		}
+	}
+}
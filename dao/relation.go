@@ -5,6 +5,7 @@ import (
 	"HiChat/models"
 	"errors"
 	"go.uber.org/zap"
+	"gorm.io/gorm"
 )
 
 // GetFriendList return Friend List by user ID
@@ -41,40 +42,19 @@ func GetRelationId(userId uint, targetId uint) uint {
 	return relation.ID
 }
 
-// AddFriendById should open transaction to guarantee consistent
-func AddFriendById(userId uint, targetId uint) error {
-	if userId == targetId {
-		zap.S().Info("userId cannot equal to targetId")
-		return errors.New("cannot add yourself as friends")
-	}
-
-	// check if targetId exist
-	targetUser, err := GetUserById(targetId)
-	if err != nil || targetUser.ID == 0 {
-		zap.S().Info("Target User is not exist")
-		return errors.New("target User is not exist")
-	}
-
+// addFriend create the friend relation records of both sides, db should be a transaction
+func addFriend(db *gorm.DB, userId uint, targetId uint) error {
 	// check if relation had existed
-	relation := models.Relation{}
-	if GetRelationId(userId, targetId) != 0 {
+	if GetRelationId(userId, targetId) != 0 || GetRelationId(targetId, userId) != 0 {
 		zap.S().Info("Relation has already existed")
 		return errors.New("relation has already existed")
 	}
 
-	if GetRelationId(targetId, userId) != 0 {
-		zap.S().Info("Relation has already existed")
-		return errors.New("relation has already existed")
-	}
-
-	// open transaction
-	tx := global.DB.Begin()
-
+	relation := models.Relation{}
 	relation.OwnerId = userId
 	relation.TargetId = targetId
 	relation.Type = 1
-	if t := tx.Create(&relation); t.RowsAffected == 0 {
-		tx.Rollback()
+	if t := db.Create(&relation); t.RowsAffected == 0 {
 		zap.S().Info("Failed to Create Relation")
 		return errors.New("failed to Create Relation")
 	}
@@ -83,29 +63,23 @@ func AddFriendById(userId uint, targetId uint) error {
 	relation.OwnerId = targetId
 	relation.TargetId = userId
 	relation.Type = 1
-	if t := tx.Create(&relation); t.RowsAffected == 0 {
-		tx.Rollback()
+	if t := db.Create(&relation); t.RowsAffected == 0 {
 		zap.S().Info("Failed to Create Relation")
 		return errors.New("failed to Create Relation")
 	}
-
-	tx.Commit()
 	return nil
 }
 
-// AddFriendByName Find Target User Id and call AddFriendById
-func AddFriendByName(userId uint, targetName string) error {
-	// check if targetUser exist
-	targetUser, err := GetUserByNameForLoginIn(targetName)
-	if err != nil || targetUser.ID == 0 {
-		zap.S().Info("Target User is not exist")
-		return errors.New("target User is not exist")
-	}
-	return AddFriendById(userId, targetUser.ID)
+// FriendUpdate describes the private data of friend to update, the nil fields are not changed
+type FriendUpdate struct {
+	Desc       *string
+	Alias      *string
+	CategoryId *uint
+	Tags       *[]string
 }
 
-// UpdateFriendRelation Update type and desc of target friend relation record
-func UpdateFriendRelation(userId uint, targetName string, r models.Relation) error {
+// UpdateFriendRelation Update the desc, alias, category and tags of target friend, only the owner side is changed
+func UpdateFriendRelation(userId uint, targetName string, update FriendUpdate) error {
 	// check if targetUser exist
 	targetUser, err := GetUserByNameForLoginIn(targetName)
 	if err != nil || targetUser.ID == 0 {
@@ -121,29 +95,48 @@ func UpdateFriendRelation(userId uint, targetName string, r models.Relation) err
 
 	// check if relation had existed
 	r1 := GetRelationId(userId, targetId)
-	r2 := GetRelationId(targetId, userId)
-	if r1 == 0 || r2 == 0 {
+	if r1 == 0 {
 		zap.S().Info("Relation didn't exist")
 		return errors.New("relation didn't exist")
 	}
 
-	// open transaction
-	tx := global.DB.Begin()
-
-	t := tx.Model(&r).Where("id = ?", r1).Updates(&r)
-	if t.RowsAffected == 0 {
-		tx.Rollback()
-		zap.S().Info("Failed to Update Relation")
-		return errors.New("failed to Update Relation")
+	// empty strings and 0 are allowed to clear the fields, so the columns are updated by map
+	updates := make(map[string]interface{})
+	if update.Desc != nil {
+		updates["desc"] = *update.Desc
 	}
-
-	t = tx.Model(&r).Where("id = ?", r2).Updates(&r)
-	if t.RowsAffected == 0 {
-		tx.Rollback()
-		zap.S().Info("Failed to Update Relation")
-		return errors.New("failed to Update Relation")
+	if update.Alias != nil {
+		updates["alias"] = *update.Alias
+	}
+	if update.CategoryId != nil {
+		if *update.CategoryId != 0 && !isCategoryOwner(userId, *update.CategoryId) {
+			zap.S().Info("Category is not exist")
+			return errors.New("category is not exist")
+		}
+		updates["category_id"] = *update.CategoryId
+	}
+	var tags []string
+	if update.Tags != nil {
+		if tags, err = normalizeTags(*update.Tags); err != nil {
+			return err
+		}
 	}
 
+	// open transaction
+	tx := global.DB.Begin()
+	if len(updates) > 0 {
+		if t := tx.Model(&models.Relation{}).Where("id = ?", r1).Updates(updates); t.Error != nil {
+			tx.Rollback()
+			zap.S().Info("Failed to Update Relation")
+			return errors.New("failed to Update Relation")
+		}
+	}
+	if update.Tags != nil {
+		if err = setFriendTags(tx, userId, targetId, tags); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
 	tx.Commit()
 	return nil
 }
@@ -153,7 +146,7 @@ func UpdateGroupRelation(gid string, r models.Relation) error {
 	group, err := FindGroupByGid(gid)
 	if err != nil {
 		zap.S().Info("Target Group is not exist")
-		return errors.New("target group is not exist")
+		return gidError(err, "target group is not exist")
 	}
 	if tx := global.DB.Model(&r).Where("id = ?", group.ID).Updates(&r); tx.RowsAffected == 0 {
 		zap.S().Info("Failed to Update Relation")
@@ -190,6 +183,9 @@ func DeleteFriendRelation(userId uint, targetName string) error {
 		zap.S().Info("Failed to Delete")
 		return errors.New("failed to Delete")
 	}
+	// the private tags of both sides are removed with the friendship
+	global.DB.Where("(owner_id = ? and target_id = ?) or (owner_id = ? and target_id = ?)", userId, targetId, targetId, userId).Delete(&models.FriendTag{})
+	models.InvalidateRecommendations(userId, targetId)
 
 	return nil
 }
@@ -0,0 +1,94 @@
+package dao
+
+import (
+	"HiChat/global"
+	"HiChat/models"
+	"errors"
+	"fmt"
+	"go.uber.org/zap"
+	"strings"
+)
+
+// MaxSearchResults the max number of users returned by a name search, no pagination to prevent enumeration
+const MaxSearchResults = 20
+
+// the user search is hidden by the privacy setting of target, or by the block list of either side
+const searchVisibleExpr = "(privacy_settings.%[1]s is null or privacy_settings.%[1]s = 0 or " +
+	"(privacy_settings.%[1]s = 1 and exists (select 1 from relations f where f.owner_id = user_basics.id and f.target_id = ? and f.type = 1 and f.deleted_at is null)))"
+
+const notBlockedExpr = "not exists (select 1 from relations b where b.type = 3 and b.deleted_at is null and " +
+	"((b.owner_id = user_basics.id and b.target_id = ?) or (b.owner_id = ? and b.target_id = user_basics.id)))"
+
+// SearchUsersByName find the users whose name starts with keyword and who can be found by the viewer
+func SearchUsersByName(viewerId uint, keyword string) ([]*models.UserBasic, error) {
+	keyword = strings.TrimSpace(keyword)
+	if keyword == "" {
+		return nil, errors.New("keyword can not be empty")
+	}
+	users := make([]*models.UserBasic, 0)
+	tx := global.DB.Model(&models.UserBasic{}).
+		Select("user_basics.*").
+		Joins("left join privacy_settings on privacy_settings.user_id = user_basics.id and privacy_settings.deleted_at is null").
+		Where("user_basics.name like ?", likeEscaper.Replace(keyword)+"%").
+		Where(fmt.Sprintf(searchVisibleExpr, "find_by_name"), viewerId).
+		Where(notBlockedExpr, viewerId, viewerId).
+		Order("user_basics.name, user_basics.id").Limit(MaxSearchResults).
+		Find(&users)
+	if tx.Error != nil {
+		zap.S().Info("Failed to search users")
+		return nil, errors.New("failed to search users")
+	}
+	return users, nil
+}
+
+// FindUserByContact find the user by exact user-visible id, phone or email, if the user can be found by the viewer
+func FindUserByContact(viewerId uint, by string, value string) (*models.UserBasic, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil, errors.New("keyword can not be empty")
+	}
+	var user *models.UserBasic
+	var err error
+	setting := func(s models.PrivacySetting) int { return s.FindByPhone }
+	switch by {
+	case "id":
+		// the user-visible id is shared by the user like the name, so it is checked against FindByName
+		user, err = GetUserByPublicId(value)
+		setting = func(s models.PrivacySetting) int { return s.FindByName }
+	case "phone":
+		user, err = GetUserByPhone(value)
+	case "email":
+		user, err = GetUserByEmail(value)
+		setting = func(s models.PrivacySetting) int { return s.FindByEmail }
+	default:
+		return nil, errors.New("invalid search type, it should be name, id, phone or email")
+	}
+	// the hidden user is reported as not found, so the existence is not leaked
+	if err != nil || !models.CanSee(viewerId, user.ID, setting(models.GetPrivacySetting(user.ID))) {
+		return nil, errors.New("didn't find the user")
+	}
+	return user, nil
+}
+
+// UpdatePrivacySetting update the privacy setting of user, the key of updates is the column name
+func UpdatePrivacySetting(userId uint, updates map[string]interface{}) (*models.PrivacySetting, error) {
+	for column, v := range updates {
+		if visibility, ok := v.(int); ok && !models.IsValidVisibility(visibility) {
+			zap.S().Info("Invalid visibility")
+			return nil, errors.New("invalid value of " + column)
+		}
+	}
+	setting := models.PrivacySetting{}
+	if tx := global.DB.Where(models.PrivacySetting{UserId: userId}).FirstOrCreate(&setting); tx.Error != nil {
+		zap.S().Info("Failed to create privacy setting")
+		return nil, errors.New("failed to update privacy setting")
+	}
+	if len(updates) > 0 {
+		if tx := global.DB.Model(&setting).Updates(updates); tx.Error != nil {
+			zap.S().Info("Failed to update privacy setting")
+			return nil, errors.New("failed to update privacy setting")
+		}
+	}
+	setting = models.GetPrivacySetting(userId)
+	return &setting, nil
+}
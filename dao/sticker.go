@@ -0,0 +1,169 @@
+package dao
+
+import (
+	"HiChat/global"
+	"HiChat/models"
+	"errors"
+	"go.uber.org/zap"
+)
+
+// CreateStickerPack create a sticker pack and install it for the creator
+/* if gid is not empty, the pack is scoped in that community and only group owner can create it */
+func CreateStickerPack(pack models.StickerPack, gid string) (*models.StickerPack, error) {
+	if gid != "" {
+		group, err := FindGroupByGid(gid)
+		if err != nil {
+			zap.S().Info("Group is not exist")
+			return nil, gidError(err, "group is not exist")
+		}
+		if group.OwnerId != pack.OwnerId {
+			zap.S().Info("Only group owner can create group sticker pack")
+			return nil, errors.New("only group owner can create group sticker pack")
+		}
+		pack.CommunityId = group.ID
+	}
+
+	tx := global.DB.Begin()
+	if t := tx.Create(&pack); t.RowsAffected == 0 {
+		tx.Rollback()
+		zap.S().Info("Failed to create sticker pack")
+		return nil, errors.New("failed to create sticker pack")
+	}
+	install := models.StickerInstall{UserId: pack.OwnerId, PackId: pack.ID}
+	if t := tx.Create(&install); t.RowsAffected == 0 {
+		tx.Rollback()
+		zap.S().Info("Failed to install sticker pack")
+		return nil, errors.New("failed to create sticker pack")
+	}
+	tx.Commit()
+	return &pack, nil
+}
+
+// GetStickerPack Find sticker pack by id
+func GetStickerPack(packId uint) (*models.StickerPack, error) {
+	pack := models.StickerPack{}
+	if tx := global.DB.Where("id = ?", packId).First(&pack); tx.RowsAffected == 0 {
+		zap.S().Info("Sticker Pack is not exist")
+		return nil, errors.New("sticker pack is not exist")
+	}
+	return &pack, nil
+}
+
+// CheckStickerPackOwner return the sticker pack if user is its owner, only the owner can add sticker
+func CheckStickerPackOwner(userId uint, packId uint) (*models.StickerPack, error) {
+	pack, err := GetStickerPack(packId)
+	if err != nil {
+		return nil, err
+	}
+	if pack.OwnerId != userId {
+		zap.S().Info("Only pack owner can add sticker")
+		return nil, errors.New("only pack owner can add sticker")
+	}
+	return pack, nil
+}
+
+// AddStickerItem add a sticker into pack, only pack owner can add stickers
+func AddStickerItem(userId uint, item models.StickerItem) (*models.StickerItem, error) {
+	pack, err := CheckStickerPackOwner(userId, item.PackId)
+	if err != nil {
+		return nil, err
+	}
+	if tx := global.DB.Create(&item); tx.RowsAffected == 0 {
+		zap.S().Info("Failed to add sticker")
+		return nil, errors.New("failed to add sticker")
+	}
+	// the first sticker is used as cover by default
+	if pack.Cover == "" {
+		global.DB.Model(pack).Update("cover", item.Url)
+	}
+	return &item, nil
+}
+
+// GetStickerItems return all stickers in pack
+func GetStickerItems(packId uint) (*[]models.StickerItem, error) {
+	items := make([]models.StickerItem, 0)
+	if tx := global.DB.Where("pack_id = ?", packId).Find(&items); tx.Error != nil {
+		zap.S().Info("Failed to get stickers")
+		return nil, errors.New("failed to get stickers")
+	}
+	return &items, nil
+}
+
+// GetInstalledPacks return the sticker packs which user has installed
+func GetInstalledPacks(userId uint) (*[]models.StickerPack, error) {
+	installs := make([]models.StickerInstall, 0)
+	if tx := global.DB.Where("user_id = ?", userId).Find(&installs); tx.RowsAffected == 0 {
+		zap.S().Info("User didn't install any sticker pack")
+		return nil, nil
+	}
+	packsId := make([]uint, 0)
+	for _, i := range installs {
+		packsId = append(packsId, i.PackId)
+	}
+	packs := make([]models.StickerPack, 0)
+	if tx := global.DB.Where("id in ?", packsId).Find(&packs); tx.RowsAffected == 0 {
+		zap.S().Info("Cannot Find Sticker Packs Record")
+		return nil, errors.New("cannot Find Sticker Packs Record")
+	}
+	return &packs, nil
+}
+
+// InstallStickerPack install a sticker pack, group-scoped pack can only be installed by group members
+func InstallStickerPack(userId uint, packId uint) error {
+	pack, err := GetStickerPack(packId)
+	if err != nil {
+		return err
+	}
+	if pack.CommunityId != 0 && !IsGroupMember(userId, pack.CommunityId) {
+		zap.S().Info("User is not the member of group")
+		return errors.New("only group members can install group sticker pack")
+	}
+
+	install := models.StickerInstall{}
+	if tx := global.DB.Where("user_id = ? and pack_id = ?", userId, packId).First(&install); tx.RowsAffected != 0 {
+		zap.S().Info("User had installed before")
+		return errors.New("sticker pack had been installed")
+	}
+	install = models.StickerInstall{UserId: userId, PackId: packId}
+	if tx := global.DB.Create(&install); tx.RowsAffected == 0 {
+		zap.S().Info("Failed to install sticker pack")
+		return errors.New("failed to install sticker pack")
+	}
+	return nil
+}
+
+// RemoveStickerPack Delete the pack if user is pack owner, otherwise uninstall the pack
+func RemoveStickerPack(userId uint, packId uint) (string, error) {
+	pack, err := GetStickerPack(packId)
+	if err != nil {
+		return "", err
+	}
+
+	if pack.OwnerId == userId {
+		// delete record in StickerPack & StickerItem & StickerInstall
+		tx := global.DB.Begin()
+		if t := tx.Where("id = ?", packId).Delete(&models.StickerPack{}); t.RowsAffected == 0 {
+			tx.Rollback()
+			zap.S().Info("Failed to delete in Table StickerPack")
+			return "", errors.New("failed to delete")
+		}
+		if t := tx.Where("pack_id = ?", packId).Delete(&models.StickerItem{}); t.Error != nil {
+			tx.Rollback()
+			zap.S().Info("Failed to delete in Table StickerItem")
+			return "", errors.New("failed to delete")
+		}
+		if t := tx.Where("pack_id = ?", packId).Delete(&models.StickerInstall{}); t.Error != nil {
+			tx.Rollback()
+			zap.S().Info("Failed to delete in Table StickerInstall")
+			return "", errors.New("failed to delete")
+		}
+		tx.Commit()
+		return "Successfully Delete the sticker pack", nil
+	}
+
+	if tx := global.DB.Where("user_id = ? and pack_id = ?", userId, packId).Delete(&models.StickerInstall{}); tx.RowsAffected == 0 {
+		zap.S().Info("Failed to uninstall")
+		return "", errors.New("sticker pack is not installed")
+	}
+	return "Successfully remove the sticker pack", nil
+}
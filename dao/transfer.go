@@ -0,0 +1,230 @@
+package dao
+
+import (
+	"HiChat/global"
+	"HiChat/models"
+	"errors"
+	"fmt"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"time"
+)
+
+// CheckOwnershipTransfer check if the owner can transfer the group to target member, and return the group
+func CheckOwnershipTransfer(userId uint, gid string, targetId uint) (*models.Community, error) {
+	group, err := FindGroupByGid(gid)
+	if err != nil {
+		zap.S().Info("Group is not exist")
+		return nil, gidError(err, "group is not exist")
+	}
+	if group.OwnerId != userId {
+		zap.S().Info("Only group owner can transfer ownership")
+		return nil, errors.New("only group owner can transfer ownership")
+	}
+	if targetId == userId {
+		zap.S().Info("Cannot transfer to yourself")
+		return nil, errors.New("cannot transfer ownership to yourself")
+	}
+	if !IsGroupMember(targetId, group.ID) {
+		zap.S().Info("Target user is not the member of group")
+		return nil, errors.New("target user is not the member of group")
+	}
+	return group, nil
+}
+
+// CreateOwnershipTransfer start transferring the ownership of group to a member, the pending transfer before is cancelled
+func CreateOwnershipTransfer(userId uint, gid string, targetId uint) (*models.OwnershipTransfer, error) {
+	group, err := CheckOwnershipTransfer(userId, gid, targetId)
+	if err != nil {
+		return nil, err
+	}
+
+	transfer := models.OwnershipTransfer{
+		CommunityId: group.ID,
+		FromId:      userId,
+		ToId:        targetId,
+		Status:      models.TransferPending,
+		ExpiredAt:   time.Now().Add(models.TransferExpiration),
+	}
+	tx := global.DB.Begin()
+	if t := tx.Model(&models.OwnershipTransfer{}).Where("community_id = ? and status = ?", group.ID, models.TransferPending).Update("status", models.TransferCancelled); t.Error != nil {
+		tx.Rollback()
+		zap.S().Info("Failed to cancel pending transfer")
+		return nil, errors.New("failed to create transfer")
+	}
+	if t := tx.Create(&transfer); t.RowsAffected == 0 {
+		tx.Rollback()
+		zap.S().Info("Failed to create transfer")
+		return nil, errors.New("failed to create transfer")
+	}
+	log := models.GroupAuditLog{CommunityId: group.ID, OperatorId: userId, Action: models.AuditTransferRequest, TargetId: targetId}
+	if err = models.WriteAuditLog(tx, log); err != nil {
+		tx.Rollback()
+		return nil, errors.New("failed to create transfer")
+	}
+	tx.Commit()
+
+	models.SendNotification(targetId, models.Notification{
+		Event:    models.EventTransferRequest,
+		FromId:   userId,
+		TargetId: group.ID,
+		Data:     transfer,
+	})
+	return &transfer, nil
+}
+
+// GetPendingTransfers return the ownership transfers waiting for user's acceptance
+func GetPendingTransfers(userId uint) (*[]models.OwnershipTransfer, error) {
+	transfers := make([]models.OwnershipTransfer, 0)
+	tx := global.DB.Where("to_id = ? and status = ? and expired_at > ?", userId, models.TransferPending, time.Now()).Find(&transfers)
+	if tx.Error != nil {
+		zap.S().Info("Failed to get transfers")
+		return nil, errors.New("failed to get transfers")
+	}
+	return &transfers, nil
+}
+
+// RespondOwnershipTransfer accept or decline the ownership transfer by the target member
+/* when accepting, the new owner takes over the group and the old owner becomes an admin */
+func RespondOwnershipTransfer(userId uint, transferId uint, accept bool) error {
+	transfer := models.OwnershipTransfer{}
+	if tx := global.DB.Where("id = ? and to_id = ? and status = ?", transferId, userId, models.TransferPending).First(&transfer); tx.RowsAffected == 0 {
+		zap.S().Info("Transfer is not exist")
+		return errors.New("transfer is not exist or has been handled")
+	}
+	if transfer.ExpiredAt.Before(time.Now()) {
+		zap.S().Info("Transfer is expired")
+		return errors.New("transfer is expired")
+	}
+
+	status, action, event := models.TransferDeclined, models.AuditTransferDecline, models.EventTransferDeclined
+	if accept {
+		status, action, event = models.TransferAccepted, models.AuditTransferAccept, models.EventTransferAccepted
+		if !IsGroupMember(userId, transfer.CommunityId) {
+			zap.S().Info("User is not the member of group")
+			return errors.New("you are not the member of group any more")
+		}
+	}
+
+	tx := global.DB.Begin()
+	t := tx.Model(&transfer).Where("status = ?", models.TransferPending).Update("status", status)
+	if t.RowsAffected == 0 {
+		tx.Rollback()
+		zap.S().Info("Transfer has been handled")
+		return errors.New("transfer has been handled")
+	}
+	if accept {
+		// the owner may have changed since the transfer was created
+		t = tx.Model(&models.Community{}).Where("id = ? and owner_id = ?", transfer.CommunityId, transfer.FromId).Update("owner_id", userId)
+		if t.RowsAffected == 0 {
+			tx.Rollback()
+			zap.S().Info("Owner of group has changed")
+			return errors.New("owner of group has changed")
+		}
+		t = tx.Model(&models.Relation{}).Where("owner_id = ? and target_id = ? and type = 2", transfer.FromId, transfer.CommunityId).Update("role", models.RoleAdmin)
+		if t.Error != nil {
+			tx.Rollback()
+			zap.S().Info("Failed to update role of old owner")
+			return errors.New("failed to transfer ownership")
+		}
+	}
+	log := models.GroupAuditLog{CommunityId: transfer.CommunityId, OperatorId: userId, Action: action, TargetId: transfer.FromId}
+	if err := models.WriteAuditLog(tx, log); err != nil {
+		tx.Rollback()
+		return errors.New("failed to handle transfer")
+	}
+	tx.Commit()
+
+	models.SendNotification(transfer.FromId, models.Notification{
+		Event:    event,
+		FromId:   userId,
+		TargetId: transfer.CommunityId,
+	})
+	return nil
+}
+
+// CancelOwnershipTransfer cancel the pending transfer by the owner who started it
+func CancelOwnershipTransfer(userId uint, transferId uint) error {
+	transfer := models.OwnershipTransfer{}
+	if tx := global.DB.Where("id = ? and from_id = ? and status = ?", transferId, userId, models.TransferPending).First(&transfer); tx.RowsAffected == 0 {
+		zap.S().Info("Transfer is not exist")
+		return errors.New("transfer is not exist or has been handled")
+	}
+
+	tx := global.DB.Begin()
+	if t := tx.Model(&transfer).Where("status = ?", models.TransferPending).Update("status", models.TransferCancelled); t.RowsAffected == 0 {
+		tx.Rollback()
+		zap.S().Info("Transfer has been handled")
+		return errors.New("transfer has been handled")
+	}
+	log := models.GroupAuditLog{CommunityId: transfer.CommunityId, OperatorId: userId, Action: models.AuditTransferCancel, TargetId: transfer.ToId}
+	if err := models.WriteAuditLog(tx, log); err != nil {
+		tx.Rollback()
+		return errors.New("failed to cancel transfer")
+	}
+	tx.Commit()
+
+	models.SendNotification(transfer.ToId, models.Notification{
+		Event:    models.EventTransferCanceled,
+		FromId:   userId,
+		TargetId: transfer.CommunityId,
+	})
+	return nil
+}
+
+// GetAuditLogs return a page of audit logs of group, newest first
+func GetAuditLogs(userId uint, gid string, page int, size int) (*[]models.GroupAuditLog, error) {
+	group, err := checkGroupPermission(userId, gid, models.PermViewAudit)
+	if err != nil {
+		return nil, err
+	}
+	logs := make([]models.GroupAuditLog, 0)
+	if tx := global.DB.Where("community_id = ?", group.ID).Order("id desc").Offset((page - 1) * size).Limit(size).Find(&logs); tx.Error != nil {
+		zap.S().Info("Failed to get audit logs")
+		return nil, errors.New("failed to get audit logs")
+	}
+	return &logs, nil
+}
+
+// fallbackOwnedGroups hand over the groups owned by the leaving user to the oldest admin, or the oldest member if there is no admin
+/* the group without any other member is deleted, db should be a transaction */
+func fallbackOwnedGroups(db *gorm.DB, userId uint) error {
+	communities := make([]models.Community, 0)
+	if tx := db.Where("owner_id = ?", userId).Find(&communities); tx.Error != nil {
+		zap.S().Info("Failed to get owned communities")
+		return errors.New("failed to get owned communities")
+	}
+
+	for _, c := range communities {
+		// quit the group first
+		if t := db.Where("owner_id = ? and target_id = ? and type = 2", userId, c.ID).Delete(&models.Relation{}); t.Error != nil {
+			zap.S().Info("Failed to quit group")
+			return errors.New("failed to quit group")
+		}
+
+		successor := models.Relation{}
+		if t := db.Where("target_id = ? and type = 2", c.ID).Order("role desc, id asc").First(&successor); t.RowsAffected == 0 {
+			if t = db.Delete(&c); t.Error != nil {
+				zap.S().Info("Failed to delete orphaned community")
+				return errors.New("failed to delete orphaned community")
+			}
+			continue
+		}
+
+		if t := db.Model(&c).Update("owner_id", successor.OwnerId); t.Error != nil {
+			zap.S().Info("Failed to update owner")
+			return errors.New("failed to update owner")
+		}
+		db.Model(&models.OwnershipTransfer{}).Where("community_id = ? and status = ?", c.ID, models.TransferPending).Update("status", models.TransferCancelled)
+		log := models.GroupAuditLog{
+			CommunityId: c.ID,
+			Action:      models.AuditOwnerFallback,
+			TargetId:    successor.OwnerId,
+			Detail:      fmt.Sprintf("owner %d deleted the account", userId),
+		}
+		if err := models.WriteAuditLog(db, log); err != nil {
+			return errors.New("failed to write audit log")
+		}
+	}
+	return nil
+}
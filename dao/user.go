@@ -63,6 +63,15 @@ func GetUserById(id uint) (*models.UserBasic, error) {
 	return &user, nil
 }
 
+// GetUserByPublicId Query User by user-visible id, see common.GenerateId
+func GetUserByPublicId(publicId string) (*models.UserBasic, error) {
+	id, err := common.ParseId(common.UserIdPrefix, publicId)
+	if err != nil {
+		return nil, errors.New("invalid user id")
+	}
+	return GetUserById(id)
+}
+
 // GetUserByPhone Query User by Phone, Used in Login in
 func GetUserByPhone(phone string) (*models.UserBasic, error) {
 	var user models.UserBasic
@@ -83,12 +92,17 @@ func GetUserByEmail(email string) (*models.UserBasic, error) {
 
 // CreateUser create User
 func CreateUser(user models.UserBasic) error {
+	user.PhoneHash = common.HashContact(common.NormalizePhone(user.Phone))
+	user.EmailHash = common.HashContact(common.NormalizeEmail(user.Email))
 	tx := global.DB.Create(&user)
 	if tx.RowsAffected == 0 {
 		// Log the Error
 		zap.S().Info("Create User Failed")
 		return errors.New("create User Failed")
 	}
+	if user.PhoneHash != "" || user.EmailHash != "" {
+		notifyContactJoined(&user)
+	}
 	return nil
 }
 
@@ -102,22 +116,47 @@ func UpdateUser(user models.UserBasic) error {
 		Phone:    user.Phone,
 		Email:    user.Email,
 		Salt:     user.Salt,
+
+		PhoneHash: common.HashContact(common.NormalizePhone(user.Phone)),
+		EmailHash: common.HashContact(common.NormalizeEmail(user.Email)),
 	})
 	if tx.RowsAffected == 0 {
 		// Log the Error
 		zap.S().Info("Update User Failed")
 		return errors.New("update User Failed")
 	}
+	// match the new phone or email with the contacts uploaded by others
+	if user.Phone != "" || user.Email != "" {
+		if u, err := GetUserById(user.ID); err == nil {
+			notifyContactJoined(u)
+		}
+	}
 	return nil
 }
 
-// DeleteUser Delete User
+// DeleteUser Delete User, the groups owned by user are handed over to other members
 func DeleteUser(user models.UserBasic) error {
-	tx := global.DB.Delete(&user)
-	if tx.RowsAffected == 0 {
+	tx := global.DB.Begin()
+	if err := fallbackOwnedGroups(tx, user.ID); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if t := tx.Delete(&user); t.RowsAffected == 0 {
+		tx.Rollback()
 		// Log the Error
 		zap.S().Info("Delete User Failed")
 		return errors.New("delete User Failed")
 	}
+	tx.Commit()
 	return nil
 }
+
+// GetUsersByIds Query Users by ids
+func GetUsersByIds(ids []uint) ([]*models.UserBasic, error) {
+	var users []*models.UserBasic
+	if tx := global.DB.Where("id in ?", ids).Find(&users); tx.Error != nil {
+		zap.S().Info("Failed to get users")
+		return nil, errors.New("failed to get users")
+	}
+	return users, nil
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"HiChat/dao"
 	"HiChat/global"
 	"HiChat/initialize"
 	"HiChat/router"
@@ -15,6 +16,11 @@ func main() {
 	initialize.InitRedis()
 	println("successfully initialize!")
 
+	// compute the stale recommendations in background
+	go dao.RunRecommendRefresher()
+	// remove the deleted groups after the grace period of restoring
+	go dao.RunGroupExpirySweeper()
+
 	// start the router (gin service)
 	r := router.Router()
 	r.Run(fmt.Sprintf(":%d", global.ServiceConfig.Port))
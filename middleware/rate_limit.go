@@ -0,0 +1,38 @@
+package middleware
+
+import (
+	"HiChat/common"
+	"HiChat/global"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"net/http"
+	"time"
+)
+
+// RateLimit limit the requests of every user to the API in a fixed window
+/*
+The counters are stored in Redis, so the limit works across server instances.
+It should be used after Authentication, and the request is allowed if Redis is unavailable.
+*/
+func RateLimit(name string, limit int64, window time.Duration) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		key := fmt.Sprintf("rate_%s_%s", name, ctx.Query("userId"))
+		count, err := global.RedisDB.Incr(ctx, key).Result()
+		if err != nil {
+			zap.S().Info("Failed to count requests: ", err)
+			ctx.Next()
+			return
+		}
+		if count == 1 {
+			global.RedisDB.Expire(ctx, key, window)
+		}
+		if count > limit {
+			zap.S().Info("Too many requests")
+			common.SendErrorResp(ctx.Writer, http.StatusTooManyRequests, "Too many requests, please try again later", nil)
+			ctx.Abort()
+			return
+		}
+		ctx.Next()
+	}
+}
@@ -0,0 +1,48 @@
+package models
+
+import (
+	"HiChat/global"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// GroupAuditLog records the important operations in group
+/*
+the params are:
+	* CommunityId: the id of community
+	* OperatorId: the user who did the operation, 0 means the system
+	* Action: kind of operation, see the Audit constants
+	* TargetId: the user the operation is about
+	* Detail: extra description of operation
+*/
+type GroupAuditLog struct {
+	gorm.Model
+	CommunityId uint
+	OperatorId  uint
+	Action      string
+	TargetId    uint
+	Detail      string
+}
+
+// the kinds of GroupAuditLog.Action
+const (
+	AuditTransferRequest = "transfer_request"
+	AuditTransferAccept  = "transfer_accept"
+	AuditTransferDecline = "transfer_decline"
+	AuditTransferCancel  = "transfer_cancel"
+	AuditOwnerFallback   = "owner_fallback"
+	AuditGroupDelete     = "group_delete"
+	AuditGroupRestore    = "group_restore"
+)
+
+// WriteAuditLog write a record of group operation, db can be a transaction
+func WriteAuditLog(db *gorm.DB, log GroupAuditLog) error {
+	if db == nil {
+		db = global.DB
+	}
+	if tx := db.Create(&log); tx.Error != nil {
+		zap.S().Info("Failed to write audit log")
+		return tx.Error
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package models
+
+import (
+	"HiChat/global"
+	"encoding/json"
+	"errors"
+	"go.uber.org/zap"
+)
+
+// IsBlocked check if the owner has blocked the target user
+func IsBlocked(ownerId uint, targetId uint) bool {
+	relation := Relation{}
+	tx := global.DB.Where("owner_id = ? and target_id = ? and type = 3", ownerId, targetId).First(&relation)
+	return tx.RowsAffected != 0
+}
+
+// IsBlockedEither check if either user has blocked the other
+func IsBlockedEither(userId uint, targetId uint) bool {
+	return IsBlocked(userId, targetId) || IsBlocked(targetId, userId)
+}
+
+// FindBlockers return the users in usersId who have blocked the target user
+func FindBlockers(targetId uint, usersId []uint) map[uint]bool {
+	blockers := make(map[uint]bool)
+	if len(usersId) == 0 {
+		return blockers
+	}
+	ids := make([]uint, 0)
+	tx := global.DB.Model(&Relation{}).Where("target_id = ? and type = 3 and owner_id in ?", targetId, usersId).Pluck("owner_id", &ids)
+	if tx.Error != nil {
+		zap.S().Info("Failed to find blockers")
+	}
+	for _, id := range ids {
+		blockers[id] = true
+	}
+	return blockers
+}
+
+// BlockedEither return the users in usersId who have blocked the user or are blocked by the user
+func BlockedEither(userId uint, usersId []uint) map[uint]bool {
+	blocked := FindBlockers(userId, usersId)
+	if len(usersId) == 0 {
+		return blocked
+	}
+	ids := make([]uint, 0)
+	tx := global.DB.Model(&Relation{}).Where("owner_id = ? and type = 3 and target_id in ?", userId, usersId).Pluck("target_id", &ids)
+	if tx.Error != nil {
+		zap.S().Info("Failed to find blocked users")
+	}
+	for _, id := range ids {
+		blocked[id] = true
+	}
+	return blocked
+}
+
+// CheckDirectMessage check if the sender can send message to the target user, by the block list and broadcast account
+/* senderId should be the user of connection(see dispatch), never the userId in frame */
+func CheckDirectMessage(senderId uint, targetId uint) error {
+	if IsBlocked(senderId, targetId) {
+		return errors.New("you have blocked this user")
+	}
+	if IsBlocked(targetId, senderId) {
+		return errors.New("message can not be delivered")
+	}
+	// the broadcast account only accepts messages from friends, unless it allows direct messages
+	if account, err := FindBroadcastAccount(targetId); err == nil && !account.AllowDirectMessage && !isFriend(senderId, targetId) {
+		return errors.New("this account does not accept direct messages")
+	}
+	return nil
+}
+
+// blockedPayload return a function choosing the payload pushed to member in group, and the members who blocked the sender
+/*
+the members who blocked the sender get a copy flagged as Blocked, so the client can collapse it,
+fromId should be the user of connection(see dispatch), never the userId in frame
+*/
+func blockedPayload(fromId uint, membersId []uint, data []byte) (func(userId uint) []byte, map[uint]bool) {
+	blockers := FindBlockers(fromId, membersId)
+	var flagged []byte
+	return func(userId uint) []byte {
+		if !blockers[userId] {
+			return data
+		}
+		if flagged == nil {
+			msg := Message{}
+			if err := json.Unmarshal(data, &msg); err != nil {
+				return data
+			}
+			msg.Blocked = true
+			var err error
+			if flagged, err = json.Marshal(msg); err != nil {
+				zap.S().Info("Failed to Marshal Message")
+				return data
+			}
+		}
+		return flagged
+	}, blockers
+}
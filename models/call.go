@@ -0,0 +1,423 @@
+package models
+
+import (
+	"HiChat/global"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go.uber.org/zap"
+	"sync"
+	"time"
+)
+
+// CallSignal is the signaling frame of 1:1 voice/video call, which is relayed by server and never stored
+/*
+the params are:
+	* FromId: the user who send the signal
+	* TargetId: the peer user of the call
+	* Type: always 3
+	* Signal: kind of signal, see the Signal constants
+	* CallId: the id of call assigned by server when inviting, required by all other signals
+	* Video: if the call is a video call, only used when inviting
+	* Payload: the SDP or ICE candidate, relayed to peer as it is
+*/
+type CallSignal struct {
+	FromId   uint            `json:"userId"`
+	TargetId uint            `json:"targetId"`
+	Type     int             `json:"Type"`
+	Signal   string          `json:"signal"`
+	CallId   string          `json:"callId"`
+	Video    bool            `json:"video"`
+	Payload  json.RawMessage `json:"payload,omitempty"`
+}
+
+// the kinds of CallSignal.Signal
+const (
+	// sent by client
+	SignalInvite    = "invite"
+	SignalRinging   = "ringing"
+	SignalAccept    = "accept"
+	SignalReject    = "reject"
+	SignalOffer     = "offer"
+	SignalAnswer    = "answer"
+	SignalCandidate = "candidate"
+	SignalHangup    = "hangup"
+	// sent by server
+	SignalCalling     = "calling"
+	SignalBusy        = "busy"
+	SignalUnavailable = "unavailable"
+	SignalTimeout     = "timeout"
+	SignalError       = "error"
+)
+
+// the status of call
+const (
+	CallRinging = "ringing"
+	CallActive  = "active"
+)
+
+const (
+	// CallRingTimeout a call not accepted in time will be treated as missed
+	CallRingTimeout = 30 * time.Second
+	// CallMaxDuration the max duration of a call, a user is treated as not busy after it
+	CallMaxDuration = 4 * time.Hour
+)
+
+// CallState is the state of a call stored in Redis, so every instance and device of user can see it
+type CallState struct {
+	CallId     string `json:"callId"`
+	CallerId   uint   `json:"callerId"`
+	CalleeId   uint   `json:"calleeId"`
+	Video      bool   `json:"video"`
+	Status     string `json:"status"`
+	StartedAt  int64  `json:"startedAt"`
+	AcceptedAt int64  `json:"acceptedAt"`
+}
+
+// the ring timers of calls created by this instance
+var callTimers = make(map[string]*time.Timer)
+var callLock sync.Mutex
+
+func callKey(callId string) string {
+	return fmt.Sprintf("call_%s", callId)
+}
+
+// the user is busy if the key exists, no matter which device he is using
+func callUserKey(userId uint) string {
+	return fmt.Sprintf("call_user_%d", userId)
+}
+
+// HandleCallSignal check the state of call and relay the signal to peer, senderId is the user of connection
+func HandleCallSignal(senderId uint, data []byte) {
+	signal := CallSignal{}
+	if err := json.Unmarshal(data, &signal); err != nil {
+		zap.S().Info("Failed to Parse to Call Signal")
+		return
+	}
+	// the participant is checked by the user of connection, never by the userId in frame
+	signal.FromId = senderId
+
+	var err error
+	switch signal.Signal {
+	case SignalInvite:
+		err = inviteCall(signal)
+	case SignalRinging, SignalOffer, SignalAnswer, SignalCandidate:
+		err = relayCallSignal(signal)
+	case SignalAccept:
+		err = acceptCall(signal)
+	case SignalReject:
+		err = rejectCall(signal)
+	case SignalHangup:
+		err = hangupCall(signal)
+	default:
+		err = errors.New("unknown signal")
+	}
+	if err != nil {
+		zap.S().Info("Failed to handle call signal: ", err)
+		sendCallSignal(signal.FromId, CallSignal{
+			FromId:   signal.TargetId,
+			TargetId: signal.FromId,
+			Signal:   SignalError,
+			CallId:   signal.CallId,
+			Payload:  errorPayload(err),
+		})
+	}
+}
+
+func inviteCall(signal CallSignal) error {
+	if signal.FromId == signal.TargetId {
+		return errors.New("cannot call yourself")
+	}
+	if !isFriend(signal.FromId, signal.TargetId) {
+		return errors.New("only friends can be called")
+	}
+	if IsBlockedEither(signal.FromId, signal.TargetId) {
+		return errors.New("the user can not be called")
+	}
+
+	ctx := context.Background()
+	now := time.Now()
+	state := CallState{
+		CallId:    fmt.Sprintf("%d_%d_%d", signal.FromId, signal.TargetId, now.UnixNano()),
+		CallerId:  signal.FromId,
+		CalleeId:  signal.TargetId,
+		Video:     signal.Video,
+		Status:    CallRinging,
+		StartedAt: now.Unix(),
+	}
+
+	// mark caller busy first, so he cannot start two calls at the same time, the users in group call room are busy too
+	if currentGroupCall(state.CallerId) != 0 {
+		return errors.New("you are already in a call")
+	}
+	if ok, _ := global.RedisDB.SetNX(ctx, callUserKey(state.CallerId), state.CallId, CallRingTimeout).Result(); !ok {
+		return errors.New("you are already in a call")
+	}
+	if currentGroupCall(state.CalleeId) != 0 {
+		global.RedisDB.Del(ctx, callUserKey(state.CallerId))
+		sendCallSignal(state.CallerId, CallSignal{FromId: state.CalleeId, TargetId: state.CallerId, Signal: SignalBusy})
+		writeCallLog(state, "busy")
+		return nil
+	}
+	if ok, _ := global.RedisDB.SetNX(ctx, callUserKey(state.CalleeId), state.CallId, CallRingTimeout).Result(); !ok {
+		global.RedisDB.Del(ctx, callUserKey(state.CallerId))
+		sendCallSignal(state.CallerId, CallSignal{FromId: state.CalleeId, TargetId: state.CallerId, Signal: SignalBusy})
+		writeCallLog(state, "busy")
+		return nil
+	}
+	if err := saveCallState(state, CallRingTimeout); err != nil {
+		clearCall(state)
+		return err
+	}
+
+	// tell caller the call id, then ring the callee
+	sendCallSignal(state.CallerId, CallSignal{FromId: state.CalleeId, TargetId: state.CallerId, Signal: SignalCalling, CallId: state.CallId, Video: state.Video})
+	signal.CallId = state.CallId
+	if !sendCallSignal(state.CalleeId, signal) {
+		sendCallSignal(state.CallerId, CallSignal{FromId: state.CalleeId, TargetId: state.CallerId, Signal: SignalUnavailable, CallId: state.CallId})
+		clearCall(state)
+		writeCallLog(state, "missed")
+		return nil
+	}
+
+	callLock.Lock()
+	callTimers[state.CallId] = time.AfterFunc(CallRingTimeout, func() { timeoutCall(state.CallId) })
+	callLock.Unlock()
+	return nil
+}
+
+func acceptCall(signal CallSignal) error {
+	state, err := getCallState(signal.CallId)
+	if err != nil {
+		return err
+	}
+	if state.CalleeId != signal.FromId || state.Status != CallRinging {
+		return errors.New("cannot accept the call")
+	}
+	stopCallTimer(state.CallId)
+
+	state.Status = CallActive
+	state.AcceptedAt = time.Now().Unix()
+	if err = saveCallState(*state, CallMaxDuration); err != nil {
+		return err
+	}
+	ctx := context.Background()
+	global.RedisDB.Expire(ctx, callUserKey(state.CallerId), CallMaxDuration)
+	global.RedisDB.Expire(ctx, callUserKey(state.CalleeId), CallMaxDuration)
+
+	signal.TargetId = state.CallerId
+	sendCallSignal(state.CallerId, signal)
+	return nil
+}
+
+func rejectCall(signal CallSignal) error {
+	state, err := getCallState(signal.CallId)
+	if err != nil {
+		return err
+	}
+	if state.CalleeId != signal.FromId || state.Status != CallRinging {
+		return errors.New("cannot reject the call")
+	}
+	stopCallTimer(state.CallId)
+	clearCall(*state)
+
+	signal.TargetId = state.CallerId
+	sendCallSignal(state.CallerId, signal)
+	writeCallLog(*state, "rejected")
+	return nil
+}
+
+func hangupCall(signal CallSignal) error {
+	state, err := getCallState(signal.CallId)
+	if err != nil {
+		return err
+	}
+	peerId, err := state.peer(signal.FromId)
+	if err != nil {
+		return err
+	}
+	stopCallTimer(state.CallId)
+	clearCall(*state)
+
+	signal.TargetId = peerId
+	sendCallSignal(peerId, signal)
+	if state.Status == CallRinging {
+		writeCallLog(*state, "cancelled")
+	} else {
+		writeCallLog(*state, "ended")
+	}
+	return nil
+}
+
+// EndCallOf end the 1:1 call of user when his connection is lost, the peer gets a hangup
+/* otherwise both users look busy until CallMaxDuration, and the peer keeps waiting */
+func EndCallOf(userId uint) {
+	ctx := context.Background()
+	callId, err := global.RedisDB.Get(ctx, callUserKey(userId)).Result()
+	if err != nil {
+		return
+	}
+	state, err := getCallState(callId)
+	if err != nil {
+		global.RedisDB.Del(ctx, callUserKey(userId))
+		return
+	}
+	peerId, err := state.peer(userId)
+	if err != nil {
+		return
+	}
+	stopCallTimer(state.CallId)
+	clearCall(*state)
+
+	sendCallSignal(peerId, CallSignal{FromId: userId, TargetId: peerId, Signal: SignalHangup, CallId: state.CallId})
+	switch {
+	case state.Status == CallActive:
+		writeCallLog(*state, "ended")
+	case userId == state.CallerId:
+		writeCallLog(*state, "cancelled")
+	default:
+		writeCallLog(*state, "missed")
+	}
+}
+
+// relayCallSignal relay the signal between the participants of call
+func relayCallSignal(signal CallSignal) error {
+	state, err := getCallState(signal.CallId)
+	if err != nil {
+		return err
+	}
+	peerId, err := state.peer(signal.FromId)
+	if err != nil {
+		return err
+	}
+	// ringing only makes sense before accepting, SDP and ICE need the peer connected
+	if signal.Signal == SignalRinging && (state.Status != CallRinging || signal.FromId != state.CalleeId) {
+		return errors.New("invalid ringing signal")
+	}
+	signal.TargetId = peerId
+	sendCallSignal(peerId, signal)
+	return nil
+}
+
+// timeoutCall end the call if it has not been accepted in time
+func timeoutCall(callId string) {
+	callLock.Lock()
+	delete(callTimers, callId)
+	callLock.Unlock()
+
+	state, err := getCallState(callId)
+	if err != nil || state.Status != CallRinging {
+		return
+	}
+	clearCall(*state)
+	sendCallSignal(state.CallerId, CallSignal{FromId: state.CalleeId, TargetId: state.CallerId, Signal: SignalTimeout, CallId: callId})
+	sendCallSignal(state.CalleeId, CallSignal{FromId: state.CallerId, TargetId: state.CalleeId, Signal: SignalTimeout, CallId: callId})
+	writeCallLog(*state, "missed")
+}
+
+func stopCallTimer(callId string) {
+	callLock.Lock()
+	defer callLock.Unlock()
+	if timer, ok := callTimers[callId]; ok {
+		timer.Stop()
+		delete(callTimers, callId)
+	}
+}
+
+// peer return the other participant of call
+func (s *CallState) peer(userId uint) (uint, error) {
+	switch userId {
+	case s.CallerId:
+		return s.CalleeId, nil
+	case s.CalleeId:
+		return s.CallerId, nil
+	}
+	return 0, errors.New("user is not in the call")
+}
+
+func getCallState(callId string) (*CallState, error) {
+	val, err := global.RedisDB.Get(context.Background(), callKey(callId)).Bytes()
+	if err != nil {
+		return nil, errors.New("call is not exist")
+	}
+	state := CallState{}
+	if err = json.Unmarshal(val, &state); err != nil {
+		return nil, errors.New("call is not exist")
+	}
+	return &state, nil
+}
+
+func saveCallState(state CallState, ttl time.Duration) error {
+	val, _ := json.Marshal(state)
+	if err := global.RedisDB.Set(context.Background(), callKey(state.CallId), val, ttl).Err(); err != nil {
+		zap.S().Info("Failed to save call state")
+		return errors.New("failed to save call state")
+	}
+	return nil
+}
+
+// clearCall remove the call state and set both participants free
+func clearCall(state CallState) {
+	ctx := context.Background()
+	global.RedisDB.Del(ctx, callKey(state.CallId))
+	for _, id := range []uint{state.CallerId, state.CalleeId} {
+		// only release the user if he is still busy with this call
+		if cur, _ := global.RedisDB.Get(ctx, callUserKey(id)).Result(); cur == state.CallId {
+			global.RedisDB.Del(ctx, callUserKey(id))
+		}
+	}
+}
+
+// writeCallLog write a call record into the conversation history and send it to both participants
+func writeCallLog(state CallState, result string) {
+	kind := "Voice call"
+	if state.Video {
+		kind = "Video call"
+	}
+	msg := Message{
+		FromId:   state.CallerId,
+		TargetId: state.CalleeId,
+		Type:     1,
+		Media:    MediaCallLog,
+		Desc:     result,
+	}
+	if result == "ended" && state.AcceptedAt != 0 {
+		msg.Duration = int(time.Now().Unix() - state.AcceptedAt)
+		msg.Content = fmt.Sprintf("%s %02d:%02d", kind, msg.Duration/60, msg.Duration%60)
+	} else {
+		msg.Content = fmt.Sprintf("%s %s", kind, result)
+	}
+	msg.Plain = msg.Content
+
+	data, err := json.Marshal(msg)
+	if err != nil {
+		zap.S().Info("Failed to Marshal Call Log")
+		return
+	}
+	SaveMessage(data)
+	SendMessageToUser(state.CallerId, data)
+	SendMessageToUser(state.CalleeId, data)
+}
+
+func sendCallSignal(userId uint, signal CallSignal) bool {
+	signal.Type = 3
+	data, err := json.Marshal(signal)
+	if err != nil {
+		zap.S().Info("Failed to Marshal Call Signal")
+		return false
+	}
+	return SendMessageToUser(userId, data)
+}
+
+func errorPayload(err error) json.RawMessage {
+	payload, _ := json.Marshal(map[string]string{"error": err.Error()})
+	return payload
+}
+
+// isFriend check if the friend relation between users exists
+func isFriend(userId uint, targetId uint) bool {
+	relation := Relation{}
+	tx := global.DB.Where("owner_id = ? and target_id = ? and type = 1", userId, targetId).First(&relation)
+	return tx.RowsAffected != 0
+}
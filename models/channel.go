@@ -0,0 +1,192 @@
+package models
+
+import (
+	"HiChat/global"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"strconv"
+)
+
+// GroupChannel is a named sub-channel in community, which has its own history, pins and unread counters
+/*
+the params are:
+	* CommunityId: the id of community
+	* CreatorId: the user who created the channel
+	* Name: name of channel, unique in community
+	* Topic: description of channel
+	* PostRole: the lowest role which can post messages in channel
+The ChannelId 0 of Message means the main channel of community, which is the group chat itself.
+*/
+type GroupChannel struct {
+	gorm.Model
+	CommunityId uint `gorm:"index"`
+	CreatorId   uint
+	Name        string
+	Topic       string
+	PostRole    int
+}
+
+// MaxChannelPins the max number of pinned messages kept in a channel
+const MaxChannelPins = 50
+
+// FindChannel find the channel of community by id
+func FindChannel(communityId uint, channelId uint) (*GroupChannel, error) {
+	channel := GroupChannel{}
+	if tx := global.DB.Where("id = ? and community_id = ?", channelId, communityId).First(&channel); tx.RowsAffected == 0 {
+		zap.S().Info("Channel is not exist")
+		return nil, errors.New("channel is not exist")
+	}
+	return &channel, nil
+}
+
+// the keys of channel records, pins and unread counters
+func channelMsgKey(communityId uint, channelId uint) string {
+	return fmt.Sprintf("channel_msg_%d_%d", communityId, channelId)
+}
+
+func channelPinKey(communityId uint, channelId uint) string {
+	return fmt.Sprintf("channel_pin_%d_%d", communityId, channelId)
+}
+
+// the sequence of the latest message in every channel of community, the field is channel id
+func channelSeqKey(communityId uint) string {
+	return fmt.Sprintf("channel_seq_%d", communityId)
+}
+
+// the sequence of the latest message read by user in channels, the field is channelField
+func channelReadKey(userId uint) string {
+	return fmt.Sprintf("channel_read_%d", userId)
+}
+
+func channelField(communityId uint, channelId uint) string {
+	return fmt.Sprintf("%d_%d", communityId, channelId)
+}
+
+// SendMessageToChannel save the message once in channel records, then push it to online members and notify the offline ones
+/*
+The unread counter of member is the sequence of channel minus the read marker of member, so a message only increases
+the sequence once instead of a counter for every member. The pin notice is also kept in channel pins.
+*/
+func SendMessageToChannel(msg Message, data []byte) {
+	TouchCommunity(msg.TargetId)
+	usersId, err := FindMembersId(msg.TargetId)
+	if err != nil {
+		zap.S().Info("Failed to Get Members Id")
+		return
+	}
+
+	ctx := context.Background()
+	saveRecord(ctx, channelMsgKey(msg.TargetId, msg.ChannelId), data)
+	if msg.Media == MediaPin {
+		pinKey := channelPinKey(msg.TargetId, msg.ChannelId)
+		pipe := global.RedisDB.TxPipeline()
+		pipe.LPush(ctx, pinKey, data)
+		pipe.LTrim(ctx, pinKey, 0, MaxChannelPins-1)
+		if _, err = pipe.Exec(ctx); err != nil {
+			zap.S().Info("Failed to store pinned message")
+		}
+	}
+
+	// the sender has read his own message
+	seq, err := global.RedisDB.HIncrBy(ctx, channelSeqKey(msg.TargetId), strconv.Itoa(int(msg.ChannelId)), 1).Result()
+	if err != nil {
+		zap.S().Info("Failed to increase channel sequence")
+	} else if err = global.RedisDB.HSet(ctx, channelReadKey(msg.FromId), channelField(msg.TargetId, msg.ChannelId), seq).Err(); err != nil {
+		zap.S().Info("Failed to update read marker")
+	}
+
+	payload, blockers := blockedPayload(msg.FromId, *usersId, data)
+	offline := make([]uint, 0)
+	for _, userId := range *usersId {
+		if userId != msg.FromId && !SendMessageToUser(userId, payload(userId)) && !blockers[userId] {
+			offline = append(offline, userId)
+		}
+	}
+	go notifyOffline(data, offline)
+}
+
+// GetChannelMsgFromRedis Get Records of channel From Redis
+func GetChannelMsgFromRedis(communityId uint, channelId uint, start int64, end int64, isRcv bool) []string {
+	return getRecords(context.Background(), channelMsgKey(communityId, channelId), start, end, isRcv)
+}
+
+// GetChannelPins return the pinned messages of channel, the latest first
+func GetChannelPins(communityId uint, channelId uint) ([]string, error) {
+	pins, err := global.RedisDB.LRange(context.Background(), channelPinKey(communityId, channelId), 0, -1).Result()
+	if err != nil {
+		zap.S().Info("Failed to get pinned messages")
+		return nil, errors.New("failed to get pinned messages")
+	}
+	return pins, nil
+}
+
+// GetChannelUnread return the unread counters of user in channels of community, the key is channel id
+func GetChannelUnread(userId uint, communityId uint, channelsId []uint) map[uint]int64 {
+	unread := make(map[uint]int64, len(channelsId))
+	if len(channelsId) == 0 {
+		return unread
+	}
+	seqFields := make([]string, 0, len(channelsId))
+	readFields := make([]string, 0, len(channelsId))
+	for _, id := range channelsId {
+		seqFields = append(seqFields, strconv.Itoa(int(id)))
+		readFields = append(readFields, channelField(communityId, id))
+	}
+	ctx := context.Background()
+	seqs, err := global.RedisDB.HMGet(ctx, channelSeqKey(communityId), seqFields...).Result()
+	if err != nil {
+		zap.S().Info("Failed to get channel sequences")
+		return unread
+	}
+	reads, err := global.RedisDB.HMGet(ctx, channelReadKey(userId), readFields...).Result()
+	if err != nil {
+		zap.S().Info("Failed to get read markers")
+		return unread
+	}
+	for i := range channelsId {
+		if n := parseCounter(seqs[i]) - parseCounter(reads[i]); n > 0 {
+			unread[channelsId[i]] = n
+		}
+	}
+	return unread
+}
+
+// parseCounter parse the value of HMGet, the missing field is 0
+func parseCounter(v interface{}) int64 {
+	s, ok := v.(string)
+	if !ok {
+		return 0
+	}
+	n, _ := strconv.ParseInt(s, 10, 64)
+	return n
+}
+
+// ClearChannelUnread move the read marker of user to the latest message of channel
+func ClearChannelUnread(userId uint, communityId uint, channelId uint) error {
+	ctx := context.Background()
+	seq, err := global.RedisDB.HGet(ctx, channelSeqKey(communityId), strconv.Itoa(int(channelId))).Int64()
+	if err != nil && err != redis.Nil {
+		zap.S().Info("Failed to get channel sequence")
+		return errors.New("failed to clear unread counter")
+	}
+	if err = global.RedisDB.HSet(ctx, channelReadKey(userId), channelField(communityId, channelId), seq).Err(); err != nil {
+		zap.S().Info("Failed to clear unread counter")
+		return errors.New("failed to clear unread counter")
+	}
+	return nil
+}
+
+// DelChannelRecords remove the records and pins of channel
+func DelChannelRecords(communityId uint, channelId uint) {
+	ctx := context.Background()
+	if err := global.RedisDB.Del(ctx, channelMsgKey(communityId, channelId), channelPinKey(communityId, channelId)).Err(); err != nil && err != redis.Nil {
+		zap.S().Info("Failed to remove channel records")
+	}
+	if err := global.RedisDB.HDel(ctx, channelSeqKey(communityId), strconv.Itoa(int(channelId))).Err(); err != nil {
+		zap.S().Info("Failed to remove channel sequence")
+	}
+}
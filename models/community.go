@@ -6,31 +6,142 @@ import (
 	"errors"
 	"go.uber.org/zap"
 	"gorm.io/gorm"
+	"time"
 )
 
 // Community describes the information of group
 /*
 the params are:
 	* Name: the name of group
-	* GroupId: the user-visible group id
+	* GroupId: the user-visible group id, see common.GenerateId
+	* LegacyGroupId: the legacy 5-char user-visible group id, kept for resolving old ids
 	* OwnerId: the group owner's userId
-	* Type: type of group
+	* Type: type of group, see the GroupType constants
 	* Image: icon of group
 	* Desc: describe of group
+	* JoinPolicy: how users join in the group, see the JoinPolicy constants
+	* IsPublic: if the group is listed in the public group directory
+	* ActiveAt: the time of latest message in group, updated at most once per minute
+	* SlowMode, MaxMessageLength, LinkRestrictHours: the anti-flood controls, see CheckFloodControl
 */
 type Community struct {
 	gorm.Model
-	Name    string
-	GroupId string
-	OwnerId uint
-	Type    int
-	Image   string
-	Desc    string
+	Name          string
+	GroupId       string `gorm:"index;type:varchar(16)"`
+	LegacyGroupId string `gorm:"index;type:varchar(8)"`
+	OwnerId       uint
+	Type          int
+	Image         string
+	Desc          string
+	JoinPolicy    int
+	IsPublic      bool `gorm:"index"`
+	ActiveAt      *time.Time
+
+	SlowMode          int
+	MaxMessageLength  int
+	LinkRestrictHours int
+}
+
+// the join policies of group
+const (
+	// JoinOpen anyone knows the group id can join in
+	JoinOpen = 0
+	// JoinByApproval a join request should be approved by admins
+	JoinByApproval = 1
+	// JoinByInvite only the users with invite link can join in
+	JoinByInvite = 2
+)
+
+// the types of group, the unknown type (such as the legacy 0) is treated as GroupTypeSmall
+const (
+	// GroupTypeSmall a small private group
+	GroupTypeSmall = 1
+	// GroupTypeLarge a large group
+	GroupTypeLarge = 2
+	// GroupTypeChannel a broadcast channel, only admins can post
+	GroupTypeChannel = 3
+)
+
+// GroupTypeConfig describes the rules of a group type
+/*
+the params are:
+	* MaxMembers: the max number of members
+	* PostRole: the lowest role which can post messages
+	* SharedFanOut: save the message once and push it to online members only,
+		instead of sending and saving for every member by SendMessageToFriendAndSave
+*/
+type GroupTypeConfig struct {
+	MaxMembers   int64
+	PostRole     int
+	SharedFanOut bool
+}
+
+// the rules of every group type
+var groupTypes = map[int]GroupTypeConfig{
+	GroupTypeSmall:   {MaxMembers: 200, PostRole: RoleMember},
+	GroupTypeLarge:   {MaxMembers: 5000, PostRole: RoleMember, SharedFanOut: true},
+	GroupTypeChannel: {MaxMembers: 100000, PostRole: RoleAdmin, SharedFanOut: true},
+}
+
+// IsValidGroupType check if the type is defined
+func IsValidGroupType(tp int) bool {
+	_, ok := groupTypes[tp]
+	return ok
+}
+
+// GetGroupTypeConfig return the rules of group type
+func GetGroupTypeConfig(tp int) GroupTypeConfig {
+	if c, ok := groupTypes[tp]; ok {
+		return c
+	}
+	return groupTypes[GroupTypeSmall]
+}
+
+// the roles of group members
+const (
+	RoleMember = 0
+	RoleAdmin  = 1
+	RoleOwner  = 2
+)
+
+// the permissions of group operations
+const (
+	PermRename = iota
+	PermChangeAvatar
+	PermEditInfo
+	PermKick
+	PermMute
+	PermPin
+	PermAnnounce
+	PermInvite
+	PermApproveJoin
+	PermViewAudit
+	PermManageAdmin
+	PermDeleteGroup
+	PermManageChannel
+)
+
+// the permission matrix of roles, owner can do everything
+var permissions = map[int]map[int]bool{
+	RoleMember: {PermInvite: true},
+	RoleAdmin: {
+		PermRename: true, PermChangeAvatar: true, PermEditInfo: true,
+		PermKick: true, PermMute: true, PermPin: true, PermAnnounce: true, PermInvite: true, PermApproveJoin: true, PermViewAudit: true,
+		PermManageChannel: true,
+	},
+}
+
+// HasPermission check if the role can do the operation
+func HasPermission(role int, perm int) bool {
+	if role == RoleOwner {
+		return true
+	}
+	return permissions[role][perm]
 }
 
 // AfterCreate Hook function, generate group id by ID
 func (c *Community) AfterCreate(tx *gorm.DB) error {
-	if t := tx.Model(c).Update("group_id", common.GenerateId(c.ID)); t.RowsAffected == 0 {
+	if t := tx.Model(c).Update("group_id", common.GenerateId(common.GroupIdPrefix, c.ID)); t.RowsAffected == 0 {
 		zap.S().Info("failed to add group id")
 		return errors.New("failed to add group id")
 	}
@@ -50,3 +161,108 @@ func FindMembersId(id uint) (*[]uint, error) {
 	}
 	return &membersId, nil
 }
+
+// GetMemberRole return the role of user in community, return error if user is not a member
+func GetMemberRole(userId uint, communityId uint) (int, error) {
+	_, role, err := GetMembership(userId, communityId)
+	return role, err
+}
+
+// GetMembership return the relation and role of user in community, return error if user is not a member
+func GetMembership(userId uint, communityId uint) (*Relation, int, error) {
+	community, err := FindCommunity(communityId)
+	if err != nil {
+		return nil, 0, err
+	}
+	relation := Relation{}
+	if tx := global.DB.Where("owner_id = ? and target_id = ? and type = 2", userId, communityId).First(&relation); tx.RowsAffected == 0 {
+		zap.S().Info("User is not the member of group")
+		return nil, 0, errors.New("user is not the member of group")
+	}
+	if community.OwnerId == userId {
+		return &relation, RoleOwner, nil
+	}
+	return &relation, relation.Role, nil
+}
+
+// FindCommunity find community by id
+func FindCommunity(id uint) (*Community, error) {
+	community := Community{}
+	if tx := global.DB.Where("id = ?", id).First(&community); tx.RowsAffected == 0 {
+		zap.S().Info("Community is not exist")
+		return nil, errors.New("group is not exist")
+	}
+	return &community, nil
+}
+
+// CountMembers return the number of members in community
+func CountMembers(db *gorm.DB, communityId uint) int64 {
+	var count int64
+	db.Model(&Relation{}).Where("target_id = ? and type = 2", communityId).Count(&count)
+	return count
+}
+
+// CommunityBan records the user who is banned from joining in community
+type CommunityBan struct {
+	gorm.Model
+	CommunityId uint
+	UserId      uint
+	OperatorId  uint
+}
+
+// IsBanned check if user is banned from community
+func IsBanned(userId uint, communityId uint) bool {
+	ban := CommunityBan{}
+	tx := global.DB.Where("community_id = ? and user_id = ?", communityId, userId).First(&ban)
+	return tx.RowsAffected != 0
+}
+
+// CheckGroupMessage check if the sender can post the message in community
+/* it returns the slow mode which the message is under, see CheckFloodControl */
+func CheckGroupMessage(msg *Message) (time.Duration, error) {
+	relation, role, err := GetMembership(msg.FromId, msg.TargetId)
+	if err != nil {
+		return 0, err
+	}
+	if relation.MutedUntil != nil && relation.MutedUntil.After(time.Now()) {
+		return 0, errors.New("you are muted until " + relation.MutedUntil.Format("2006-01-02 15:04:05"))
+	}
+	community, err := FindCommunity(msg.TargetId)
+	if err != nil {
+		return 0, err
+	}
+	if role < GetGroupTypeConfig(community.Type).PostRole {
+		return 0, errors.New("permission denied: only admins can post in channel")
+	}
+	if msg.ChannelId != 0 {
+		channel, err := FindChannel(msg.TargetId, msg.ChannelId)
+		if err != nil {
+			return 0, err
+		}
+		if role < channel.PostRole {
+			return 0, errors.New("permission denied: post in channel " + channel.Name)
+		}
+	}
+	switch msg.Media {
+	case MediaAnnouncement:
+		if !HasPermission(role, PermAnnounce) {
+			return 0, errors.New("permission denied: post announcement")
+		}
+	case MediaPin:
+		if !HasPermission(role, PermPin) {
+			return 0, errors.New("permission denied: pin message")
+		}
+	}
+	return CheckFloodControl(msg, community, relation, role)
+}
+
+// TouchCommunity update the active time of community, skip if it has been updated in a minute
+func TouchCommunity(id uint) {
+	now := time.Now()
+	tx := global.DB.Model(&Community{}).
+		Where("id = ? and (active_at is null or active_at < ?)", id, now.Add(-time.Minute)).
+		UpdateColumn("active_at", now)
+	if tx.Error != nil {
+		zap.S().Info("Failed to update active time of community")
+	}
+}
@@ -0,0 +1,43 @@
+package models
+
+import "gorm.io/gorm"
+
+// ContactCategory is a user-defined category of friends, such as "Work" or "Family"
+type ContactCategory struct {
+	gorm.Model
+	OwnerId uint `gorm:"index"`
+	Name    string
+}
+
+// FriendTag is a custom tag which the owner puts on a friend, only visible to the owner
+type FriendTag struct {
+	gorm.Model
+	OwnerId  uint `gorm:"index:idx_friend_tag"`
+	TargetId uint `gorm:"index:idx_friend_tag"`
+	Tag      string
+}
+
+// ContactHash is a hashed phone or email in the address book of owner, the raw contact is never stored
+/*
+the params are:
+	* OwnerId: the user who uploaded the address book
+	* Hash: the hashed contact, see common.HashContact
+	* MatchedId: the user matched with the hash and notified to owner, 0 means not matched yet
+*/
+type ContactHash struct {
+	gorm.Model
+	OwnerId   uint   `gorm:"index"`
+	Hash      string `gorm:"index;type:varchar(64)"`
+	MatchedId uint
+}
+
+// the limits of contact data
+const (
+	MaxCategories   = 50
+	MaxTagsOfFriend = 20
+	MaxTagLength    = 32
+	// MaxContactImport the max number of hashes in one upload
+	MaxContactImport = 5000
+	// MaxContactsOfUser the max number of hashes kept for a user
+	MaxContactsOfUser = 10000
+)
@@ -0,0 +1,213 @@
+package models
+
+import (
+	"HiChat/global"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"strconv"
+	"time"
+	"unicode/utf8"
+)
+
+// ConversationSetting is the preference of user on a friend chat or group chat
+/*
+the params are:
+	* OwnerId: the owner of setting
+	* TargetId: the friend id or community id
+	* Type: 1 means friend chat, 2 means group chat, the same as Message.Type
+	* Muted: if the conversation is muted, no push is sent for it
+	* MutedUntil: when the mute ends, nil means muted forever
+	* PinnedAt: when the conversation was pinned, nil means not pinned, pinned conversations are ordered by it
+	* Archived: the archived conversation is hidden from the conversation list by default
+*/
+type ConversationSetting struct {
+	gorm.Model
+	OwnerId    uint `gorm:"uniqueIndex:idx_conversation"`
+	TargetId   uint `gorm:"uniqueIndex:idx_conversation"`
+	Type       int  `gorm:"uniqueIndex:idx_conversation"`
+	Muted      bool
+	MutedUntil *time.Time
+	PinnedAt   *time.Time
+	Archived   bool
+}
+
+// the limits of conversations
+const (
+	MaxPinnedConversations = 10
+	MaxPushPreviewLength   = 100
+	// MaxPushQueueLength the pending push tasks are trimmed to it, in case the push gateway is down
+	MaxPushQueueLength = 100000
+)
+
+// IsMuted check if the conversation is muted at the time
+func (s *ConversationSetting) IsMuted(now time.Time) bool {
+	return s.Muted && (s.MutedUntil == nil || s.MutedUntil.After(now))
+}
+
+// the key of conversation activities, the member is ConversationField and the score is unix time of last message
+func conversationKey(userId uint) string {
+	return fmt.Sprintf("conversation_%d", userId)
+}
+
+// the key of unread counters of messages received when user is offline, the field is ConversationField
+func offlineUnreadKey(userId uint) string {
+	return fmt.Sprintf("offline_unread_%d", userId)
+}
+
+// PushQueueKey the Redis list of PushTask, which is consumed by the push gateway
+const PushQueueKey = "push_queue"
+
+// ConversationField return the field of conversation in the Redis keys and the activity maps
+func ConversationField(chatType int, targetId uint) string {
+	return fmt.Sprintf("%d_%d", chatType, targetId)
+}
+
+// PushTask asks the push gateway to notify an offline user of new message
+type PushTask struct {
+	UserId   uint   `json:"userId"`
+	FromId   uint   `json:"fromId"`
+	TargetId uint   `json:"targetId"`
+	Type     int    `json:"type"`
+	Preview  string `json:"preview"`
+}
+
+// touchConversation update the last active time of friend chat for both users
+func touchConversation(msg *Message) {
+	ctx := context.Background()
+	now := float64(time.Now().Unix())
+	pipe := global.RedisDB.Pipeline()
+	pipe.ZAdd(ctx, conversationKey(msg.FromId), redis.Z{Score: now, Member: ConversationField(1, msg.TargetId)})
+	pipe.ZAdd(ctx, conversationKey(msg.TargetId), redis.Z{Score: now, Member: ConversationField(1, msg.FromId)})
+	if _, err := pipe.Exec(ctx); err != nil {
+		zap.S().Info("Failed to update active time of conversation")
+	}
+}
+
+// MaxNotifyBatch the max number of offline users notified by one query and one pipeline
+const MaxNotifyBatch = 1000
+
+// notifyOffline count the unread message of offline users, and queue push tasks for the ones not muted the conversation
+/*
+The mute settings are loaded and the Redis writes are sent by batch, so a message to a large group costs a few round trips.
+The message flagged as Blocked is not counted or pushed, and the message of sub-channel is only pushed.
+*/
+func notifyOffline(data []byte, usersId []uint) {
+	if len(usersId) == 0 {
+		return
+	}
+	msg := Message{}
+	if err := json.Unmarshal(data, &msg); err != nil {
+		zap.S().Info("Failed to Parse data to Message")
+		return
+	}
+	if msg.Blocked || msg.Media == MediaLocationUpdate {
+		return
+	}
+	// the conversation of friend chat is named by the other user, and of group chat by the community
+	targetId := msg.FromId
+	if msg.Type == 2 {
+		targetId = msg.TargetId
+	}
+	field := ConversationField(msg.Type, targetId)
+
+	preview := msg.Plain
+	if preview == "" {
+		preview = msg.Content
+	}
+	if utf8.RuneCountInString(preview) > MaxPushPreviewLength {
+		preview = string([]rune(preview)[:MaxPushPreviewLength])
+	}
+
+	ctx := context.Background()
+	for start := 0; start < len(usersId); start += MaxNotifyBatch {
+		end := start + MaxNotifyBatch
+		if end > len(usersId) {
+			end = len(usersId)
+		}
+		batch := usersId[start:end]
+		muted := findMutedUsers(batch, targetId, msg.Type)
+
+		pipe := global.RedisDB.Pipeline()
+		for _, userId := range batch {
+			// the messages of sub-channel are counted by channel sequence, see GetChannelUnread
+			if msg.ChannelId == 0 {
+				pipe.HIncrBy(ctx, offlineUnreadKey(userId), field, 1)
+			}
+			if muted[userId] {
+				continue
+			}
+			task, err := json.Marshal(PushTask{UserId: userId, FromId: msg.FromId, TargetId: targetId, Type: msg.Type, Preview: preview})
+			if err != nil {
+				zap.S().Info("Failed to Marshal PushTask")
+				continue
+			}
+			pipe.LPush(ctx, PushQueueKey, task)
+		}
+		pipe.LTrim(ctx, PushQueueKey, 0, MaxPushQueueLength-1)
+		if _, err := pipe.Exec(ctx); err != nil {
+			zap.S().Info("Failed to notify offline users")
+		}
+	}
+}
+
+// findMutedUsers return the users who have muted the conversation now
+func findMutedUsers(usersId []uint, targetId uint, chatType int) map[uint]bool {
+	muted := make(map[uint]bool)
+	settings := make([]ConversationSetting, 0)
+	tx := global.DB.Where("owner_id in ? and target_id = ? and type = ? and muted = ?", usersId, targetId, chatType, true).Find(&settings)
+	if tx.Error != nil {
+		zap.S().Info("Failed to get conversation settings")
+		return muted
+	}
+	now := time.Now()
+	for i := range settings {
+		if settings[i].IsMuted(now) {
+			muted[settings[i].OwnerId] = true
+		}
+	}
+	return muted
+}
+
+// ConversationActivity return the unread counters and last active time of friend chats, the key is ConversationField
+func ConversationActivity(userId uint, fields []string) (map[string]int64, map[string]time.Time) {
+	unread := make(map[string]int64, len(fields))
+	activeAt := make(map[string]time.Time, len(fields))
+	if len(fields) == 0 {
+		return unread, activeAt
+	}
+	ctx := context.Background()
+	counters, err := global.RedisDB.HMGet(ctx, offlineUnreadKey(userId), fields...).Result()
+	if err != nil {
+		zap.S().Info("Failed to get unread counters")
+	}
+	for i, v := range counters {
+		if s, ok := v.(string); ok {
+			n, _ := strconv.ParseInt(s, 10, 64)
+			unread[fields[i]] = n
+		}
+	}
+	scores, err := global.RedisDB.ZMScore(ctx, conversationKey(userId), fields...).Result()
+	if err != nil {
+		zap.S().Info("Failed to get active time of conversations")
+	}
+	for i, score := range scores {
+		if score > 0 {
+			activeAt[fields[i]] = time.Unix(int64(score), 0)
+		}
+	}
+	return unread, activeAt
+}
+
+// ClearOfflineUnread reset the unread counter of conversation
+func ClearOfflineUnread(userId uint, chatType int, targetId uint) error {
+	if err := global.RedisDB.HDel(context.Background(), offlineUnreadKey(userId), ConversationField(chatType, targetId)).Err(); err != nil {
+		zap.S().Info("Failed to clear unread counter")
+		return errors.New("failed to clear unread counter")
+	}
+	return nil
+}
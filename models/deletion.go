@@ -0,0 +1,81 @@
+package models
+
+import (
+	"HiChat/global"
+	"context"
+	"encoding/json"
+	"fmt"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"time"
+)
+
+// GroupDeletion records a soft deletion of group, the owner can restore the group before it expires
+/*
+the params are:
+	* CommunityId: the id of deleted community
+	* OperatorId: the owner who deleted the group
+	* HistoryPolicy: how the message history is handled, see the History constants
+	* DeletedTime: the deleted_at written into the community and its members, used to find them when restoring
+	* ExpiredAt: the group cannot be restored after it
+	* Restored: if the group has been restored
+	* Purged: if the expired group has been removed with its history, see RunGroupExpirySweeper
+*/
+type GroupDeletion struct {
+	gorm.Model
+	CommunityId   uint `gorm:"index"`
+	OperatorId    uint
+	HistoryPolicy int
+	DeletedTime   time.Time
+	ExpiredAt     time.Time
+	Restored      bool
+	Purged        bool
+}
+
+// the policies of message history when deleting group
+const (
+	// HistoryArchive keep the history, which comes back when the group is restored
+	HistoryArchive = 0
+	// HistoryPurge remove the history immediately, a restored group starts with empty history
+	HistoryPurge = 1
+)
+
+// GroupRestoreGrace how long a deleted group can be restored
+const GroupRestoreGrace = 30 * 24 * time.Hour
+
+// PurgeGroupHistory remove the records of group in Redis
+/*
+The records of main channel are stored with the records of senders(see SaveMessage), so only the group
+messages are removed from the keys of members, and the records of sub-channels are removed entirely.
+*/
+func PurgeGroupHistory(communityId uint, membersId []uint, channelsId []uint) {
+	ctx := context.Background()
+	for _, userId := range membersId {
+		var key string
+		if userId < communityId {
+			key = fmt.Sprintf("msg_%d_%d", userId, communityId)
+		} else {
+			key = fmt.Sprintf("msg_%d_%d", communityId, userId)
+		}
+		records, err := global.RedisDB.ZRange(ctx, key, 0, -1).Result()
+		if err != nil {
+			zap.S().Info("Failed to get records")
+			continue
+		}
+		removed := make([]interface{}, 0)
+		for _, r := range records {
+			msg := Message{}
+			if json.Unmarshal([]byte(r), &msg) == nil && msg.Type == 2 && msg.TargetId == communityId {
+				removed = append(removed, r)
+			}
+		}
+		if len(removed) > 0 {
+			if err = global.RedisDB.ZRem(ctx, key, removed...).Err(); err != nil {
+				zap.S().Info("Failed to remove records")
+			}
+		}
+	}
+	for _, channelId := range channelsId {
+		DelChannelRecords(communityId, channelId)
+	}
+}
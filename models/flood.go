@@ -0,0 +1,80 @@
+package models
+
+import (
+	"HiChat/global"
+	"context"
+	"errors"
+	"fmt"
+	"go.uber.org/zap"
+	"regexp"
+	"time"
+	"unicode/utf8"
+)
+
+// the limits of anti-flood controls
+const (
+	MaxSlowMode          = 6 * 60 * 60
+	MaxMessageTextLength = 4096
+	MaxLinkRestrictHours = 7 * 24
+)
+
+var linkPattern = regexp.MustCompile(`(?i)(https?://|mailto:|www\.)`)
+
+// the key of slow mode is divided by community and member, it expires after the slow mode seconds
+func slowModeKey(communityId uint, userId uint) string {
+	return fmt.Sprintf("slow_mode_%d_%d", communityId, userId)
+}
+
+// CheckFloodControl check the message against the anti-flood controls of community, admins are exempt
+/*
+* MaxMessageLength: the max characters of text content, 0 means no limit
+* LinkRestrictHours: the members who joined in less than the hours can not post links, 0 means no limit
+* SlowMode: the min seconds between messages of a member, 0 means no limit
+The slow mode is counted in Redis, so it works across server instances. It only checks the slow mode, and returns the
+seconds of slow mode which the message is under, the slot is taken by TakeSlowModeSlot after the message passes all checks.
+*/
+func CheckFloodControl(msg *Message, community *Community, relation *Relation, role int) (time.Duration, error) {
+	if role >= RoleAdmin || msg.Media == MediaLocationUpdate {
+		return 0, nil
+	}
+
+	if community.MaxMessageLength > 0 && utf8.RuneCountInString(msg.Content) > community.MaxMessageLength {
+		return 0, fmt.Errorf("message is too long, the max length is %d", community.MaxMessageLength)
+	}
+
+	if community.LinkRestrictHours > 0 &&
+		relation.CreatedAt.Add(time.Duration(community.LinkRestrictHours)*time.Hour).After(time.Now()) &&
+		(linkPattern.MatchString(msg.Content) || linkPattern.MatchString(msg.Desc)) {
+		return 0, fmt.Errorf("new members can not post links in the first %d hours", community.LinkRestrictHours)
+	}
+
+	if community.SlowMode <= 0 {
+		return 0, nil
+	}
+	ttl, err := global.RedisDB.TTL(context.Background(), slowModeKey(community.ID, msg.FromId)).Result()
+	if err != nil {
+		zap.S().Info("Failed to check slow mode")
+		return 0, errors.New("failed to check slow mode")
+	}
+	if ttl > 0 {
+		return 0, fmt.Errorf("slow mode is on, please wait %d seconds", int(ttl.Seconds())+1)
+	}
+	return time.Duration(community.SlowMode) * time.Second, nil
+}
+
+// TakeSlowModeSlot take the slot of slow mode for the message of member, the next message can be sent after slowMode
+func TakeSlowModeSlot(communityId uint, userId uint, slowMode time.Duration) error {
+	ctx := context.Background()
+	key := slowModeKey(communityId, userId)
+	ok, err := global.RedisDB.SetNX(ctx, key, 1, slowMode).Result()
+	if err != nil {
+		zap.S().Info("Failed to check slow mode")
+		return errors.New("failed to check slow mode")
+	}
+	if !ok {
+		// another message has taken the slot after it was checked
+		ttl, _ := global.RedisDB.TTL(ctx, key).Result()
+		return fmt.Errorf("slow mode is on, please wait %d seconds", int(ttl.Seconds())+1)
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package models
+
+import (
+	"HiChat/global"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// BroadcastAccount marks a user as an official or broadcast account, which can be followed by other users
+/*
+the params are:
+	* UserId: the user of account
+	* AllowDirectMessage: if the users who are not friends of account can send direct messages to it
+The followers are the Relation records with Type = 4, and the posts are the Message with Type = 6.
+*/
+type BroadcastAccount struct {
+	gorm.Model
+	UserId             uint `gorm:"uniqueIndex"`
+	AllowDirectMessage bool
+}
+
+// FindBroadcastAccount find the broadcast account of user
+func FindBroadcastAccount(userId uint) (*BroadcastAccount, error) {
+	account := BroadcastAccount{}
+	if tx := global.DB.Where("user_id = ?", userId).First(&account); tx.RowsAffected == 0 {
+		return nil, errors.New("account is not a broadcast account")
+	}
+	return &account, nil
+}
+
+// IsFollower check if user follows the broadcast account
+func IsFollower(userId uint, accountId uint) bool {
+	relation := Relation{}
+	tx := global.DB.Where("owner_id = ? and target_id = ? and type = 4", userId, accountId).First(&relation)
+	return tx.RowsAffected != 0
+}
+
+// FindFollowersId return the userId of all followers of account
+func FindFollowersId(accountId uint) ([]uint, error) {
+	followersId := make([]uint, 0)
+	if tx := global.DB.Model(&Relation{}).Where("target_id = ? and type = 4", accountId).Pluck("owner_id", &followersId); tx.Error != nil {
+		zap.S().Info("Failed to get followers")
+		return nil, errors.New("failed to get followers")
+	}
+	return followersId, nil
+}
+
+// the key of posts of broadcast account, which is shared by all followers
+func feedKey(accountId uint) string {
+	return fmt.Sprintf("feed_%d", accountId)
+}
+
+// the key of post sequence of broadcast account, which is the score of post in feed
+func feedSeqKey(accountId uint) string {
+	return fmt.Sprintf("feed_seq_%d", accountId)
+}
+
+// CheckBroadcastPost check if the sender is a broadcast account, the FromId and TargetId of post are always the account itself
+/* senderId should be the user of connection(see dispatch), never the userId in frame */
+func CheckBroadcastPost(senderId uint, msg *Message) error {
+	if _, err := FindBroadcastAccount(senderId); err != nil {
+		return errors.New("only broadcast accounts can post")
+	}
+	if msg.Media == MediaLiveLocation || msg.Media == MediaLocationUpdate {
+		return errors.New("live location can not be posted")
+	}
+	msg.FromId = senderId
+	msg.TargetId = senderId
+	return nil
+}
+
+// SendBroadcastPost save the post once in the feed of account, then push it to online followers
+func SendBroadcastPost(msg Message, data []byte) {
+	followersId, err := FindFollowersId(msg.FromId)
+	if err != nil {
+		return
+	}
+	// the score is taken from a counter, so the growing feed is never loaded when posting
+	ctx := context.Background()
+	seq, err := global.RedisDB.Incr(ctx, feedSeqKey(msg.FromId)).Result()
+	if err != nil {
+		zap.S().Info("Failed to get post sequence")
+		return
+	}
+	if err = global.RedisDB.ZAdd(ctx, feedKey(msg.FromId), redis.Z{Score: float64(seq), Member: data}).Err(); err != nil {
+		zap.S().Info("Failed to store post")
+		return
+	}
+	for _, userId := range followersId {
+		SendMessageToUser(userId, data)
+	}
+}
+
+// GetFeedFromRedis Get Posts of broadcast account From Redis
+func GetFeedFromRedis(accountId uint, start int64, end int64, isRcv bool) []string {
+	return getRecords(context.Background(), feedKey(accountId), start, end, isRcv)
+}
@@ -0,0 +1,36 @@
+package models
+
+import (
+	"gorm.io/gorm"
+	"time"
+)
+
+// FriendRequest records a request of making friends, the friend relation is created only after it is accepted
+/*
+the params are:
+	* FromId: the userId of sender
+	* ToId: the userId of recipient
+	* Greeting: the message left by sender
+	* Status: status of request, see the FriendRequest constants
+	* ExpiredAt: the request cannot be handled after it
+*/
+type FriendRequest struct {
+	gorm.Model
+	FromId    uint `gorm:"index"`
+	ToId      uint `gorm:"index"`
+	Greeting  string
+	Status    int
+	ExpiredAt time.Time
+}
+
+// the status of FriendRequest
+const (
+	FriendRequestPending  = 0
+	FriendRequestAccepted = 1
+	FriendRequestRejected = 2
+	// FriendRequestIgnored the request is closed without telling the sender
+	FriendRequestIgnored = 3
+)
+
+// FriendRequestExpiration how long a friend request waits for handling
+const FriendRequestExpiration = 7 * 24 * time.Hour
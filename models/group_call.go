@@ -0,0 +1,287 @@
+package models
+
+import (
+	"HiChat/global"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go.uber.org/zap"
+	"sort"
+	"time"
+)
+
+// GroupCallSignal is the signaling frame of group voice/video call room, which is relayed by server and never stored
+/*
+the params are:
+	* FromId: the user who send the signal
+	* TargetId: the id of community which the call room belongs to
+	* Type: always 4
+	* Signal: kind of signal, see the Signal constants
+	* PeerId: the participant that offer/answer/candidate is sent to
+	* Muted: the mute state of sender, used by start/join/mute
+	* Video: if the sender turns on camera, used by start/join/mute
+	* Payload: the SDP or ICE candidate, relayed to peer as it is
+	* Participants: the participant list of room, filled in by server
+*/
+type GroupCallSignal struct {
+	FromId       uint                   `json:"userId"`
+	TargetId     uint                   `json:"targetId"`
+	Type         int                    `json:"Type"`
+	Signal       string                 `json:"signal"`
+	PeerId       uint                   `json:"peerId"`
+	Muted        bool                   `json:"muted"`
+	Video        bool                   `json:"video"`
+	Payload      json.RawMessage        `json:"payload,omitempty"`
+	Participants []GroupCallParticipant `json:"participants,omitempty"`
+}
+
+// GroupCallParticipant is a member in the call room
+type GroupCallParticipant struct {
+	UserId   uint  `json:"userId"`
+	Muted    bool  `json:"muted"`
+	Video    bool  `json:"video"`
+	JoinedAt int64 `json:"joinedAt"`
+}
+
+// the kinds of GroupCallSignal.Signal, offer/answer/candidate/error are shared with CallSignal
+const (
+	// sent by client
+	SignalStart = "start"
+	SignalJoin  = "join"
+	SignalLeave = "leave"
+	SignalMute  = "mute"
+	// sent by server
+	SignalParticipants = "participants"
+	SignalClosed       = "closed"
+)
+
+// the room is a Redis hash of userId and participant, so every instance can see it
+func groupCallKey(communityId uint) string {
+	return fmt.Sprintf("group_call_%d", communityId)
+}
+
+// the community id of the call room which user is in, a user can be in one room at a time
+func groupCallUserKey(userId uint) string {
+	return fmt.Sprintf("group_call_user_%d", userId)
+}
+
+// currentGroupCall return the community id of call room which user is in, 0 if he is not in any room
+func currentGroupCall(userId uint) uint {
+	cid, err := global.RedisDB.Get(context.Background(), groupCallUserKey(userId)).Uint64()
+	if err != nil {
+		return 0
+	}
+	return uint(cid)
+}
+
+// HandleGroupCallSignal check the membership of sender and handle the signal of call room, senderId is the user of connection
+func HandleGroupCallSignal(senderId uint, data []byte) {
+	signal := GroupCallSignal{}
+	if err := json.Unmarshal(data, &signal); err != nil {
+		zap.S().Info("Failed to Parse to Group Call Signal")
+		return
+	}
+	// the membership is checked by the user of connection, never by the userId in frame
+	signal.FromId = senderId
+
+	membersId, err := FindMembersId(signal.TargetId)
+	if err == nil && !containsId(*membersId, signal.FromId) {
+		err = errors.New("user is not the member of group")
+	}
+	if err == nil {
+		switch signal.Signal {
+		case SignalStart, SignalJoin:
+			err = joinGroupCall(signal, *membersId)
+		case SignalLeave:
+			err = leaveGroupCall(signal, *membersId)
+		case SignalMute:
+			err = muteGroupCall(signal, *membersId)
+		case SignalOffer, SignalAnswer, SignalCandidate:
+			err = relayGroupCallSignal(signal)
+		default:
+			err = errors.New("unknown signal")
+		}
+	}
+	if err != nil {
+		zap.S().Info("Failed to handle group call signal: ", err)
+		sendGroupCallSignal(signal.FromId, GroupCallSignal{
+			TargetId: signal.TargetId,
+			Signal:   SignalError,
+			Payload:  errorPayload(err),
+		})
+	}
+}
+
+func joinGroupCall(signal GroupCallSignal, membersId []uint) error {
+	ctx := context.Background()
+	key := groupCallKey(signal.TargetId)
+
+	exist, err := global.RedisDB.Exists(ctx, key).Result()
+	if err != nil {
+		return errors.New("failed to get call room")
+	}
+	if exist == 0 && signal.Signal == SignalJoin {
+		return errors.New("no active call in group")
+	}
+	// a user in 1:1 call or in call room of another group is busy
+	if cur, _ := global.RedisDB.Get(ctx, callUserKey(signal.FromId)).Result(); cur != "" {
+		return errors.New("you are already in a call")
+	}
+	if cid := currentGroupCall(signal.FromId); cid != 0 && cid != signal.TargetId {
+		return errors.New("you are already in a call")
+	}
+
+	participant := GroupCallParticipant{
+		UserId:   signal.FromId,
+		Muted:    signal.Muted,
+		Video:    signal.Video,
+		JoinedAt: time.Now().Unix(),
+	}
+	if err = saveGroupCallParticipant(key, participant); err != nil {
+		return err
+	}
+	global.RedisDB.Expire(ctx, key, CallMaxDuration)
+	global.RedisDB.Set(ctx, groupCallUserKey(signal.FromId), signal.TargetId, CallMaxDuration)
+	return broadcastGroupCall(signal.TargetId, membersId)
+}
+
+// leaveGroupCall remove user from call room, and close the room when it is empty
+func leaveGroupCall(signal GroupCallSignal, membersId []uint) error {
+	if !removeGroupCallParticipant(signal.FromId, signal.TargetId) {
+		return errors.New("user is not in the call")
+	}
+	return broadcastGroupCall(signal.TargetId, membersId)
+}
+
+// removeGroupCallParticipant remove user from the call room of community, return false if he is not in it
+func removeGroupCallParticipant(userId uint, communityId uint) bool {
+	ctx := context.Background()
+	if currentGroupCall(userId) == communityId {
+		global.RedisDB.Del(ctx, groupCallUserKey(userId))
+	}
+	n, _ := global.RedisDB.HDel(ctx, groupCallKey(communityId), fmt.Sprint(userId)).Result()
+	return n != 0
+}
+
+// RemoveFromGroupCall remove user from the call room of community, used when he is kicked or quits the group
+/* communityId 0 means the room which user is in, used when he disconnects */
+func RemoveFromGroupCall(userId uint, communityId uint) {
+	if communityId == 0 {
+		if communityId = currentGroupCall(userId); communityId == 0 {
+			return
+		}
+	}
+	if !removeGroupCallParticipant(userId, communityId) {
+		return
+	}
+	membersId, err := FindMembersId(communityId)
+	if err != nil {
+		zap.S().Info("Failed to Get Members Id")
+		return
+	}
+	if err = broadcastGroupCall(communityId, *membersId); err != nil {
+		zap.S().Info("Failed to broadcast participants: ", err)
+	}
+}
+
+func muteGroupCall(signal GroupCallSignal, membersId []uint) error {
+	key := groupCallKey(signal.TargetId)
+	val, err := global.RedisDB.HGet(context.Background(), key, fmt.Sprint(signal.FromId)).Bytes()
+	if err != nil {
+		return errors.New("user is not in the call")
+	}
+	participant := GroupCallParticipant{}
+	if err = json.Unmarshal(val, &participant); err != nil {
+		return errors.New("user is not in the call")
+	}
+	participant.Muted = signal.Muted
+	participant.Video = signal.Video
+	if err = saveGroupCallParticipant(key, participant); err != nil {
+		return err
+	}
+	return broadcastGroupCall(signal.TargetId, membersId)
+}
+
+// relayGroupCallSignal relay SDP or ICE candidate to a participant, both users should be in the room
+func relayGroupCallSignal(signal GroupCallSignal) error {
+	participants, err := GetGroupCallParticipants(signal.TargetId)
+	if err != nil {
+		return err
+	}
+	var hasSender, hasPeer bool
+	for _, p := range participants {
+		hasSender = hasSender || p.UserId == signal.FromId
+		hasPeer = hasPeer || p.UserId == signal.PeerId
+	}
+	if !hasSender || !hasPeer || signal.FromId == signal.PeerId {
+		return errors.New("peer is not in the call")
+	}
+	sendGroupCallSignal(signal.PeerId, signal)
+	return nil
+}
+
+// GetGroupCallParticipants return the participants of call room ordered by join time, empty if no active call
+func GetGroupCallParticipants(communityId uint) ([]GroupCallParticipant, error) {
+	vals, err := global.RedisDB.HVals(context.Background(), groupCallKey(communityId)).Result()
+	if err != nil {
+		zap.S().Info("Failed to get call room")
+		return nil, errors.New("failed to get call room")
+	}
+	participants := make([]GroupCallParticipant, 0, len(vals))
+	for _, v := range vals {
+		p := GroupCallParticipant{}
+		if json.Unmarshal([]byte(v), &p) == nil {
+			participants = append(participants, p)
+		}
+	}
+	sort.Slice(participants, func(i, j int) bool {
+		return participants[i].JoinedAt < participants[j].JoinedAt
+	})
+	return participants, nil
+}
+
+// broadcastGroupCall send the participant list to all members, or close the room if it is empty
+func broadcastGroupCall(communityId uint, membersId []uint) error {
+	participants, err := GetGroupCallParticipants(communityId)
+	if err != nil {
+		return err
+	}
+	notice := GroupCallSignal{TargetId: communityId, Signal: SignalParticipants, Participants: participants}
+	if len(participants) == 0 {
+		global.RedisDB.Del(context.Background(), groupCallKey(communityId))
+		notice.Signal = SignalClosed
+	}
+	for _, id := range membersId {
+		sendGroupCallSignal(id, notice)
+	}
+	return nil
+}
+
+func saveGroupCallParticipant(key string, participant GroupCallParticipant) error {
+	val, _ := json.Marshal(participant)
+	if err := global.RedisDB.HSet(context.Background(), key, fmt.Sprint(participant.UserId), val).Err(); err != nil {
+		zap.S().Info("Failed to save participant")
+		return errors.New("failed to join call room")
+	}
+	return nil
+}
+
+func sendGroupCallSignal(userId uint, signal GroupCallSignal) bool {
+	signal.Type = 4
+	data, err := json.Marshal(signal)
+	if err != nil {
+		zap.S().Info("Failed to Marshal Group Call Signal")
+		return false
+	}
+	return SendMessageToUser(userId, data)
+}
+
+func containsId(ids []uint, id uint) bool {
+	for _, i := range ids {
+		if i == id {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,51 @@
+package models
+
+import (
+	"gorm.io/gorm"
+	"time"
+)
+
+// JoinRequest records a request of joining in group which requires approval
+/*
+the params are:
+	* CommunityId: the id of community
+	* UserId: the applicant's userId
+	* Greeting: the message left by applicant
+	* Status: status of request, see the JoinRequest constants
+	* OperatorId: the admin who approved or rejected the request
+*/
+type JoinRequest struct {
+	gorm.Model
+	CommunityId uint
+	UserId      uint
+	Greeting    string
+	Status      int
+	OperatorId  uint
+}
+
+// the status of JoinRequest
+const (
+	JoinRequestPending  = 0
+	JoinRequestApproved = 1
+	JoinRequestRejected = 2
+)
+
+// InviteLink is a token which grants membership of group directly
+/*
+the params are:
+	* CommunityId: the id of community
+	* CreatorId: the userId of link creator
+	* Token: the random token in link
+	* MaxUses: the max times the link can be used, 0 means unlimited
+	* Uses: the times the link has been used
+	* ExpiredAt: the expire time of link, nil means never expire
+*/
+type InviteLink struct {
+	gorm.Model
+	CommunityId uint
+	CreatorId   uint
+	Token       string `gorm:"uniqueIndex;type:varchar(64)"`
+	MaxUses     int
+	Uses        int
+	ExpiredAt   *time.Time
+}
@@ -0,0 +1,151 @@
+package models
+
+import (
+	"HiChat/global"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+	"time"
+)
+
+// MaxLiveLocationDuration the max seconds of a live location sharing
+const MaxLiveLocationDuration = 8 * 60 * 60
+
+// LivePoint is the latest point of a live location sharing, which is stored in Redis until sharing ends
+type LivePoint struct {
+	FromId    uint    `json:"userId"`
+	Latitude  float64 `json:"lat"`
+	Longitude float64 `json:"lng"`
+	Place     string  `json:"place"`
+	UpdatedAt int64   `json:"updatedAt"`
+	ExpiredAt int64   `json:"expiredAt"`
+}
+
+// CheckCoordinate check if the latitude and longitude is validated
+func CheckCoordinate(lat, lng float64) error {
+	if lat < -90 || lat > 90 || lng < -180 || lng > 180 {
+		return errors.New("invalid coordinate")
+	}
+	return nil
+}
+
+// LocationPlainText return the plain-text fallback of location message
+func LocationPlainText(msg *Message) string {
+	switch {
+	case msg.Media == MediaLiveLocation && msg.Duration == 0:
+		return "[Live Location] stopped"
+	case msg.Media == MediaLiveLocation || msg.Media == MediaLocationUpdate:
+		return "[Live Location]"
+	case msg.Place != "":
+		return "[Location] " + msg.Place
+	default:
+		return fmt.Sprintf("[Location] %.6f,%.6f", msg.Latitude, msg.Longitude)
+	}
+}
+
+// the key of live location is divided by chat type, sharer and target(user or group)
+func liveLocationKey(tp int, fromId uint, targetId uint) string {
+	return fmt.Sprintf("live_location_%d_%d_%d", tp, fromId, targetId)
+}
+
+// UpdateLiveLocation start, update or stop the live location sharing of message sender
+/*
+* MediaLiveLocation with Duration > 0 start sharing, the point expired after Duration seconds
+* MediaLiveLocation with Duration = 0 stop sharing, and the point is removed
+* MediaLocationUpdate overwrite the latest point, only if the sharing is active
+ */
+func UpdateLiveLocation(msg *Message) error {
+	ctx := context.Background()
+	key := liveLocationKey(msg.Type, msg.FromId, msg.TargetId)
+
+	if msg.Media == MediaLiveLocation && msg.Duration == 0 {
+		if err := global.RedisDB.Del(ctx, key).Err(); err != nil {
+			zap.S().Info("Failed to stop live location")
+			return errors.New("failed to stop live location")
+		}
+		return nil
+	}
+
+	now := time.Now()
+	point := LivePoint{
+		FromId:    msg.FromId,
+		Latitude:  msg.Latitude,
+		Longitude: msg.Longitude,
+		Place:     msg.Place,
+		UpdatedAt: now.Unix(),
+	}
+
+	if msg.Media == MediaLiveLocation {
+		if msg.Duration < 0 || msg.Duration > MaxLiveLocationDuration {
+			return errors.New("invalid live location duration")
+		}
+		point.ExpiredAt = now.Unix() + int64(msg.Duration)
+		val, _ := json.Marshal(point)
+		if err := global.RedisDB.Set(ctx, key, val, time.Duration(msg.Duration)*time.Second).Err(); err != nil {
+			zap.S().Info("Failed to start live location")
+			return errors.New("failed to start live location")
+		}
+		return nil
+	}
+
+	// keep the expire time of sharing
+	old, err := global.RedisDB.Get(ctx, key).Bytes()
+	if err != nil {
+		zap.S().Info("Live location is not active")
+		return errors.New("live location sharing is not active")
+	}
+	prev := LivePoint{}
+	if err = json.Unmarshal(old, &prev); err != nil {
+		return errors.New("live location sharing is broken")
+	}
+	point.ExpiredAt = prev.ExpiredAt
+	msg.Duration = int(prev.ExpiredAt - now.Unix())
+
+	val, _ := json.Marshal(point)
+	err = global.RedisDB.SetArgs(ctx, key, val, redis.SetArgs{Mode: "XX", KeepTTL: true}).Err()
+	if err != nil {
+		zap.S().Info("Live location is not active")
+		return errors.New("live location sharing is not active")
+	}
+	return nil
+}
+
+// GetLiveLocations return the active live locations shared to user by friend, or shared in group by members
+func GetLiveLocations(userId uint, targetId uint, tp int) ([]LivePoint, error) {
+	keys := make([]string, 0)
+	switch tp {
+	case 1:
+		keys = append(keys, liveLocationKey(1, targetId, userId), liveLocationKey(1, userId, targetId))
+	case 2:
+		membersId, err := FindMembersId(targetId)
+		if err != nil {
+			return nil, err
+		}
+		for _, id := range *membersId {
+			keys = append(keys, liveLocationKey(2, id, targetId))
+		}
+	default:
+		return nil, errors.New("type is Invalid, it should be 1 or 2")
+	}
+
+	vals, err := global.RedisDB.MGet(context.Background(), keys...).Result()
+	if err != nil {
+		zap.S().Info("Failed to get live locations")
+		return nil, errors.New("failed to get live locations")
+	}
+	points := make([]LivePoint, 0)
+	for _, v := range vals {
+		str, ok := v.(string)
+		if !ok {
+			continue
+		}
+		point := LivePoint{}
+		if json.Unmarshal([]byte(str), &point) == nil {
+			points = append(points, point)
+		}
+	}
+	return points, nil
+}
@@ -1,19 +1,24 @@
 package models
 
 import (
+	"HiChat/common"
 	"HiChat/global"
 	"context"
+	"encoding/binary"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/gorilla/websocket"
 	"github.com/redis/go-redis/v9"
 	"go.uber.org/zap"
 	"gopkg.in/fatih/set.v0"
 	"gorm.io/gorm"
+	"html"
 	"net"
 	"net/http"
 	"strconv"
 	"sync"
+	"time"
 )
 
 // Message define the structure of message
@@ -21,37 +26,120 @@ import (
 the params are:
 	* FromId: message sender id
 	* TargetId: message receiver id
-	* Type: type of chat, including chatting in group or to user
+	* Type: type of chat, 1 means chatting to user, 2 means chatting in group,
+		3 means 1:1 call signaling(see CallSignal), 4 means group call signaling(see GroupCallSignal),
+		6 means a post of broadcast account to its followers(see BroadcastAccount),
+		0 and 5 are only sent by server as ErrorFrame and Notification
 	* Media: type of message media, including text and file(such as picture and voice data)
-	* Content: content of text message
+	* Content: content of text message, the normalized markdown source if Media is MediaMarkdown or MediaAnnouncement
 	* Url: the url of file
 	* Desc: description of file
+	* Html: the sanitized html of text content, rendered by server for the web client
+	* Plain: the plain-text fallback of text content, used in notifications and search
+	* StickerId: the id of StickerItem if Media is MediaSticker, the Url is filled in by server
+	* Latitude, Longitude, Place: the coordinates and optional place name of location media
+	* Duration: seconds of live location sharing, 0 means stop sharing
+	* ChannelId: the GroupChannel of group message, 0 means the main channel
+	* Blocked: set by server when the recipient has blocked the sender in group, the client should collapse it
 */
 type Message struct {
 	gorm.Model
-	FromId   uint `json:"userId"`
-	TargetId uint `json:"targetId"`
-	Type     int
-	Media    int
-	Content  string
-	Url      string `json:"url"`
-	Desc     string
+	FromId    uint `json:"userId"`
+	TargetId  uint `json:"targetId"`
+	Type      int
+	Media     int
+	Content   string
+	Url       string `json:"url"`
+	Desc      string
+	Html      string  `json:"html"`
+	Plain     string  `json:"plain"`
+	StickerId uint    `json:"stickerId"`
+	Latitude  float64 `json:"lat"`
+	Longitude float64 `json:"lng"`
+	Place     string  `json:"place"`
+	Duration  int     `json:"duration"`
+	ChannelId uint    `json:"channelId"`
+	Blocked   bool    `json:"blocked,omitempty"`
 }
 
+// the kinds of Message.Media
+const (
+	MediaText     = 1
+	MediaEmoji    = 2
+	MediaImage    = 3
+	MediaVoice    = 4
+	MediaMarkdown = 5
+	MediaSticker  = 6
+	// MediaLocation a static location
+	MediaLocation = 7
+	// MediaLiveLocation start (Duration > 0) or stop (Duration = 0) a live location sharing
+	MediaLiveLocation = 8
+	// MediaLocationUpdate a position update of live location, which is ephemeral
+	MediaLocationUpdate = 9
+	// MediaCallLog a call record written by server when a call ends
+	MediaCallLog = 10
+	// MediaAnnouncement a markdown announcement in group, only posted by admins
+	MediaAnnouncement = 11
+	// MediaPin a notice of pinning message in group, Content is the pinned text
+	MediaPin = 12
+)
+
 // MarshalBinary marshal Message to []byte
 func (msg Message) MarshalBinary() ([]byte, error) {
 	return json.Marshal(msg)
 }
 
+// FormatContent validate the content by media type, and fill in the sanitized html and plain-text fallback
+func (msg *Message) FormatContent() error {
+	switch msg.Media {
+	case MediaText, MediaPin:
+		msg.Html = html.EscapeString(msg.Content)
+		msg.Plain = msg.Content
+	case MediaMarkdown, MediaAnnouncement:
+		rich, err := common.ParseMarkdown(msg.Content)
+		if err != nil {
+			return err
+		}
+		msg.Content = rich.Markdown
+		msg.Html = rich.Html
+		msg.Plain = rich.Plain
+	case MediaSticker:
+		// sticker is referenced by id, never trust the url sent by client
+		item, err := FindStickerForMessage(msg)
+		if err != nil {
+			return err
+		}
+		msg.Content = ""
+		msg.Url = item.Url
+		msg.Html = ""
+		msg.Plain = "[" + item.Name + "]"
+	case MediaLocation, MediaLiveLocation, MediaLocationUpdate:
+		if err := CheckCoordinate(msg.Latitude, msg.Longitude); err != nil {
+			return err
+		}
+		msg.Html = ""
+		msg.Plain = LocationPlainText(msg)
+	case MediaCallLog:
+		return errors.New("call log can only be written by server")
+	default:
+		// file message has no text to render, never trust the html sent by client
+		msg.Html = ""
+		msg.Plain = msg.Desc
+	}
+	return nil
+}
+
 // MsgNode is a node bind to a specific User to send and receive Message
 /*
 the params are:
+	* UserId: the user bind to the node
 	* Conn: a connection of websocket
 	* Addr: address of user
 	* DataQueue: message queue
 	* GroupSets: indicate group or friend
 */
 type MsgNode struct {
+	UserId    uint
 	Conn      *websocket.Conn
 	Addr      string
 	DataQueue chan []byte
@@ -61,8 +149,21 @@ type MsgNode struct {
 // the map of userId and MesNode
 var clientMap = make(map[uint]*MsgNode, 0)
 
+// frame is the data received from the websocket of user
+/* the sender of frame is always the user bind to the connection, the userId in data is never trusted */
+type frame struct {
+	userId uint
+	data   []byte
+}
+
 // a global channel to store the message sending to a Parse and HangOut UDP Server
-var udpSendChan = make(chan []byte, 1024)
+var udpSendChan = make(chan frame, 1024)
+
+// the size of sender id written before the data in UDP packet
+const frameHeaderSize = 8
+
+// the max size of a frame relayed by UDP Server, the packet with header should fit in a UDP payload (65507 bytes)
+const maxFrameSize = 65507 - frameHeaderSize
 
 // a lock for binding user and msgNode
 var lock sync.RWMutex
@@ -97,6 +198,7 @@ func Chat(w http.ResponseWriter, r *http.Request) {
 
 	// new a MsgNode
 	msgNode := MsgNode{
+		UserId:    uint(userId),
 		Conn:      conn,
 		DataQueue: make(chan []byte, 50),
 		GroupSets: set.New(set.ThreadSafe),
@@ -133,11 +235,31 @@ func RecDataBySocket(node *MsgNode) {
 		_, data, err := node.Conn.ReadMessage()
 		if err != nil {
 			zap.S().Info("Failed to get Message: ", err)
+			// unbind the node if user has not reconnected by another node
+			lock.Lock()
+			unbound := clientMap[node.UserId] == node
+			if unbound {
+				delete(clientMap, node.UserId)
+			}
+			lock.Unlock()
+			// the login out time is shown as the last seen time, see PrivacyView.Presence
+			if unbound {
+				global.DB.Model(&UserBasic{}).Where("id = ?", node.UserId).UpdateColumn("login_out_time", time.Now())
+				EndCallOf(node.UserId)
+				RemoveFromGroupCall(node.UserId, 0)
+			}
 			return
 		}
 
+		// the frame can not be relayed by UDP Server if it is too large
+		if len(data) > maxFrameSize {
+			zap.S().Info("Frame is too large: ", len(data))
+			SendErrorFrame(Message{FromId: node.UserId}, fmt.Errorf("message is too large, the max size is %d bytes", maxFrameSize))
+			continue
+		}
+
 		// store in UDP Channel to send data to UDP Server
-		udpSendChan <- data
+		udpSendChan <- frame{userId: node.UserId, data: data}
 	}
 }
 
@@ -158,11 +280,13 @@ func UdpSendData() {
 	// receive data and send it
 	for true {
 		select {
-		case data := <-udpSendChan:
-			_, err := udpConn.Write(data)
-			if err != nil {
-				zap.S().Info("Failed to send udp data")
-				return
+		case f := <-udpSendChan:
+			packet := make([]byte, frameHeaderSize+len(f.data))
+			binary.BigEndian.PutUint64(packet, uint64(f.userId))
+			copy(packet[frameHeaderSize:], f.data)
+			// a failed frame is dropped, the sending loop keeps serving the others
+			if _, err := udpConn.Write(packet); err != nil {
+				zap.S().Info("Failed to send udp data: ", err)
 			}
 		}
 	}
@@ -181,18 +305,21 @@ func UdpRecData() {
 	}
 	defer udpConn.Close()
 	for true {
-		var buf [1024]byte
+		var buf [frameHeaderSize + maxFrameSize]byte
 		n, err := udpConn.Read(buf[0:])
 		if err != nil {
 			zap.S().Info("Failed to Read Data")
 			return
 		}
-		dispatch(buf[0:n])
+		if n < frameHeaderSize {
+			continue
+		}
+		dispatch(uint(binary.BigEndian.Uint64(buf[:frameHeaderSize])), buf[frameHeaderSize:n])
 	}
 }
 
-// Parse the Data to Message And send to friend/group
-func dispatch(data []byte) {
+// Parse the Data to Message And send to friend/group, senderId is the user of connection which sent the data
+func dispatch(senderId uint, data []byte) {
 	// Parse to Message
 	msg := Message{}
 	err := json.Unmarshal(data, &msg)
@@ -201,32 +328,181 @@ func dispatch(data []byte) {
 		return
 	}
 
+	// Call signaling will not be stored or rendered
+	if msg.Type == 3 {
+		HandleCallSignal(senderId, data)
+		return
+	}
+	if msg.Type == 4 {
+		HandleGroupCallSignal(senderId, data)
+		return
+	}
+
+	// the sender is the user of connection, so the checks below can not be bypassed by a forged userId
+	msg.FromId = senderId
+
+	// Sanitize the content, the stored and forwarded message is always the server rendered one
+	if err = msg.FormatContent(); err != nil {
+		zap.S().Info("Invalid Message Content: ", err)
+		SendErrorFrame(msg, err)
+		return
+	}
+
+	// Check the membership and permission of sender in group, and the block list in direct message
+	msg.Blocked = false
+	var slowMode time.Duration
+	if msg.Type == 2 {
+		if slowMode, err = CheckGroupMessage(&msg); err != nil {
+			zap.S().Info("Reject Group Message: ", err)
+			SendErrorFrame(msg, err)
+			return
+		}
+	} else if msg.Type == 6 {
+		msg.ChannelId = 0
+		if err = CheckBroadcastPost(senderId, &msg); err != nil {
+			zap.S().Info("Reject Broadcast Post: ", err)
+			SendErrorFrame(msg, err)
+			return
+		}
+	} else {
+		msg.ChannelId = 0
+		if err = CheckDirectMessage(senderId, msg.TargetId); err != nil {
+			zap.S().Info("Reject Direct Message: ", err)
+			SendErrorFrame(msg, err)
+			return
+		}
+	}
+
+	// Live location only keeps the latest point until sharing ends
+	if msg.Media == MediaLiveLocation || msg.Media == MediaLocationUpdate {
+		if err = UpdateLiveLocation(&msg); err != nil {
+			zap.S().Info("Failed to Update Live Location: ", err)
+			SendErrorFrame(msg, err)
+			return
+		}
+	}
+
+	// The slot of slow mode is taken only when the message passes all checks above
+	if slowMode > 0 {
+		if err = TakeSlowModeSlot(msg.TargetId, msg.FromId, slowMode); err != nil {
+			zap.S().Info("Reject Group Message: ", err)
+			SendErrorFrame(msg, err)
+			return
+		}
+	}
+
+	if data, err = json.Marshal(msg); err != nil {
+		zap.S().Info("Failed to Marshal Message")
+		return
+	}
+
+	// Position updates go through the ephemeral path, which will not be stored in records
+	if msg.Media == MediaLocationUpdate {
+		SendEphemeralMessage(msg, data)
+		return
+	}
+
 	// Send Message
 	switch msg.Type {
 	case 1:
 		// send message to friend
+		touchConversation(&msg)
 		SendMessageToFriendAndSave(msg.TargetId, data)
 	case 2:
-		// send message to group
+		// send message to group, the sub-channel has its own records
+		if msg.ChannelId != 0 {
+			SendMessageToChannel(msg, data)
+			return
+		}
 		SendMessageToCommunity(msg.FromId, msg.TargetId, data)
+	case 6:
+		// post to the followers of broadcast account
+		SendBroadcastPost(msg, data)
 	}
 
 }
 
-// SendMessageToFriendAndSave send message to friend
-func SendMessageToFriendAndSave(id uint, msg []byte) {
+// SendMessageToUser push message to the socket of target user, return false if user is offline
+func SendMessageToUser(id uint, msg []byte) bool {
 	lock.Lock()
 	node, ok := clientMap[id]
 	lock.Unlock()
 	if !ok {
 		zap.S().Info("Failed to Get Target User Node")
-		return
+		return false
 	}
 
 	// send message by socket
 	zap.S().Info("Target Id: ", id, "Node: ", node)
 	node.DataQueue <- msg
+	return true
+}
+
+// IsOnline check if user has connected to the websocket of server
+func IsOnline(id uint) bool {
+	lock.RLock()
+	_, ok := clientMap[id]
+	lock.RUnlock()
+	return ok
+}
+
+// ErrorFrame is sent to user when the frame he sent is rejected by server
+/*
+the params are:
+	* Type: always 0
+	* TargetId: the targetId of rejected frame
+	* Media: the media of rejected frame
+	* Error: the reason of rejection
+*/
+type ErrorFrame struct {
+	Type     int    `json:"Type"`
+	TargetId uint   `json:"targetId"`
+	Media    int    `json:"Media"`
+	Error    string `json:"error"`
+}
 
+// SendErrorFrame tell the sender why his message is rejected
+func SendErrorFrame(msg Message, err error) {
+	data, e := json.Marshal(ErrorFrame{TargetId: msg.TargetId, Media: msg.Media, Error: err.Error()})
+	if e != nil {
+		zap.S().Info("Failed to Marshal Error Frame")
+		return
+	}
+	SendMessageToUser(msg.FromId, data)
+}
+
+// SendEphemeralMessage send message to online friend/group members without saving it in records
+func SendEphemeralMessage(msg Message, data []byte) {
+	switch msg.Type {
+	case 1:
+		SendMessageToUser(msg.TargetId, data)
+	case 2:
+		usersId, err := FindMembersId(msg.TargetId)
+		if err != nil {
+			zap.S().Info("Failed to Get Members Id")
+			return
+		}
+		payload, _ := blockedPayload(msg.FromId, *usersId, data)
+		for _, userId := range *usersId {
+			if userId != msg.FromId {
+				SendMessageToUser(userId, payload(userId))
+			}
+		}
+	}
+}
+
+// SendMessageToFriendAndSave send message to friend
+/* the message is always saved, if friend is offline, it is counted as unread and pushed unless the conversation is muted */
+func SendMessageToFriendAndSave(id uint, msg []byte) {
+	online := SendMessageToUser(id, msg)
+	SaveMessage(msg)
+	if !online {
+		notifyOffline(msg, []uint{id})
+	}
+}
+
+// SaveMessage store the message in the records of conversation
+func SaveMessage(msg []byte) {
 	// Parse to Message
 	message := Message{}
 	err := json.Unmarshal(msg, &message)
@@ -242,9 +518,12 @@ func SendMessageToFriendAndSave(id uint, msg []byte) {
 	} else {
 		key = fmt.Sprintf("msg_%d_%d", message.TargetId, message.FromId)
 	}
+	saveRecord(context.Background(), key, msg)
+}
 
+// saveRecord append the message to the records of key
+func saveRecord(ctx context.Context, key string, msg []byte) {
 	// get the number of record
-	ctx := context.Background()
 	res, err := global.RedisDB.ZRevRange(ctx, key, 0, -1).Result()
 	if err != nil {
 		zap.S().Info("Failed to create record")
@@ -266,16 +545,39 @@ func SendMessageToFriendAndSave(id uint, msg []byte) {
 
 // SendMessageToCommunity find all user in the group and send to them
 func SendMessageToCommunity(fromId, targetId uint, msg []byte) {
+	community, err := FindCommunity(targetId)
+	if err != nil {
+		zap.S().Info("Failed to Get Community")
+		return
+	}
+	TouchCommunity(targetId)
 	usersId, err := FindMembersId(targetId)
 	if err != nil {
 		zap.S().Info("Failed to Get Members Id")
 		return
 	}
+
+	// large group and channel save the message once, and only push it to online members
+	payload, blockers := blockedPayload(fromId, *usersId, msg)
+	shared := GetGroupTypeConfig(community.Type).SharedFanOut
+	if shared {
+		SaveMessage(msg)
+	}
+	// the offline members (except the ones blocked the sender) are notified together out of the hub
+	offline := make([]uint, 0)
 	for _, userId := range *usersId {
-		if userId != fromId {
-			SendMessageToFriendAndSave(userId, msg)
+		if userId == fromId {
+			continue
+		}
+		if !SendMessageToUser(userId, payload(userId)) {
+			if !blockers[userId] {
+				offline = append(offline, userId)
+			}
+		} else if !shared {
+			SaveMessage(msg)
 		}
 	}
+	go notifyOffline(msg, offline)
 }
 
 // GetMsgFromRedis Get Records From Redis
@@ -287,8 +589,11 @@ func GetMsgFromRedis(idA uint, idB uint, start int64, end int64, isRcv bool) []s
 	} else {
 		key = fmt.Sprintf("msg_%d_%d", idB, idA)
 	}
+	return getRecords(context.Background(), key, start, end, isRcv)
+}
 
-	ctx := context.Background()
+// getRecords return the records of key in range
+func getRecords(ctx context.Context, key string, start int64, end int64, isRcv bool) []string {
 	var result []string
 	var err error
 	if isRcv {
@@ -0,0 +1,56 @@
+package models
+
+import (
+	"encoding/json"
+	"go.uber.org/zap"
+)
+
+// Notification is a realtime event pushed by server through websocket, which is not stored in records
+/*
+the params are:
+	* Type: always 5
+	* Event: kind of event, see the Event constants
+	* FromId: the user who triggered the event
+	* TargetId: the user or group the event is about
+	* Data: extra information of event
+*/
+type Notification struct {
+	Type     int         `json:"Type"`
+	Event    string      `json:"event"`
+	FromId   uint        `json:"userId"`
+	TargetId uint        `json:"targetId"`
+	Data     interface{} `json:"data,omitempty"`
+}
+
+// the kinds of Notification.Event
+const (
+	EventJoinRequest  = "join_request"
+	EventJoinApproved = "join_approved"
+	EventJoinRejected = "join_rejected"
+	EventGroupInvited = "group_invited"
+	// ownership transfer
+	EventTransferRequest  = "transfer_request"
+	EventTransferAccepted = "transfer_accepted"
+	EventTransferDeclined = "transfer_declined"
+	EventTransferCanceled = "transfer_cancelled"
+	// friend request
+	EventFriendRequest  = "friend_request"
+	EventFriendAccepted = "friend_accepted"
+	EventFriendRejected = "friend_rejected"
+	// a contact in address book becomes a HiChat user
+	EventContactJoined = "contact_joined"
+	// group deletion
+	EventGroupDeleted  = "group_deleted"
+	EventGroupRestored = "group_restored"
+)
+
+// SendNotification push the notification to user if he is online
+func SendNotification(userId uint, n Notification) bool {
+	n.Type = 5
+	data, err := json.Marshal(n)
+	if err != nil {
+		zap.S().Info("Failed to Marshal Notification")
+		return false
+	}
+	return SendMessageToUser(userId, data)
+}
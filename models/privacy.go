@@ -0,0 +1,173 @@
+package models
+
+import (
+	"HiChat/global"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"time"
+)
+
+// PrivacySetting describes who can find, contact and see the user, a user without the record uses the zero values
+/*
+the params are:
+	* UserId: the owner of setting
+	* FindByName, FindByPhone, FindByEmail: who can find the user in user search and contact import
+	* FriendRequest: who can send friend requests, see the RequestFrom constants
+	* OnlineStatus: who can see the online status and last seen time
+	* AddToGroup: who can add the user into groups directly
+	* ShowAvatar, ShowPhone, ShowEmail: who can see the avatar, phone and email
+The settings except FriendRequest are the Visibility constants.
+*/
+type PrivacySetting struct {
+	gorm.Model
+	UserId        uint `gorm:"uniqueIndex"`
+	FindByName    int
+	FindByPhone   int
+	FindByEmail   int
+	FriendRequest int
+	OnlineStatus  int
+	AddToGroup    int
+	ShowAvatar    int
+	ShowPhone     int
+	ShowEmail     int
+}
+
+// the visibility of user data in PrivacySetting
+const (
+	VisibleToEveryone = 0
+	VisibleToFriends  = 1
+	VisibleToNobody   = 2
+)
+
+// who can send friend requests in PrivacySetting
+const (
+	RequestFromEveryone = 0
+	// RequestFromConnected the users who have mutual friends or shared groups with the user
+	RequestFromConnected = 1
+	RequestFromNobody    = 2
+)
+
+// IsValidVisibility check if the visibility is defined, the RequestFrom constants are in the same range
+func IsValidVisibility(v int) bool {
+	return v >= VisibleToEveryone && v <= VisibleToNobody
+}
+
+// GetPrivacySetting return the privacy setting of user, the default one if it has not been set
+func GetPrivacySetting(userId uint) PrivacySetting {
+	setting := PrivacySetting{UserId: userId}
+	global.DB.Where("user_id = ?", userId).First(&setting)
+	return setting
+}
+
+// GetPrivacySettings return the privacy settings of users, the key is user id
+func GetPrivacySettings(usersId []uint) map[uint]PrivacySetting {
+	settings := make(map[uint]PrivacySetting, len(usersId))
+	for _, id := range usersId {
+		settings[id] = PrivacySetting{UserId: id}
+	}
+	if len(usersId) == 0 {
+		return settings
+	}
+	records := make([]PrivacySetting, 0)
+	if tx := global.DB.Where("user_id in ?", usersId).Find(&records); tx.Error != nil {
+		zap.S().Info("Failed to get privacy settings")
+	}
+	for _, s := range records {
+		settings[s.UserId] = s
+	}
+	return settings
+}
+
+// Visible check if the data under the visibility can be seen, by the owner himself, a friend or a blocked user
+func Visible(visibility int, self bool, friend bool, blocked bool) bool {
+	switch {
+	case self:
+		return true
+	case blocked:
+		return false
+	case visibility == VisibleToEveryone:
+		return true
+	case visibility == VisibleToFriends:
+		return friend
+	default:
+		return false
+	}
+}
+
+// CanSee check if the viewer can see the data of owner under the visibility, the users blocked either side see nothing
+func CanSee(viewerId uint, ownerId uint, visibility int) bool {
+	if viewerId == ownerId {
+		return true
+	}
+	blocked := IsBlockedEither(viewerId, ownerId)
+	return Visible(visibility, false, !blocked && visibility == VisibleToFriends && isFriend(viewerId, ownerId), blocked)
+}
+
+// FindFriends return the users in usersId who are friends of the user
+func FindFriends(userId uint, usersId []uint) map[uint]bool {
+	friends := make(map[uint]bool)
+	if len(usersId) == 0 {
+		return friends
+	}
+	ids := make([]uint, 0)
+	tx := global.DB.Model(&Relation{}).Where("owner_id = ? and type = 1 and target_id in ?", userId, usersId).Pluck("target_id", &ids)
+	if tx.Error != nil {
+		zap.S().Info("Failed to find friends")
+	}
+	for _, id := range ids {
+		friends[id] = true
+	}
+	return friends
+}
+
+// PrivacyView applies the privacy settings of a batch of users to one viewer, the queries are done once for the batch
+type PrivacyView struct {
+	viewerId uint
+	settings map[uint]PrivacySetting
+	friends  map[uint]bool
+	blocked  map[uint]bool
+}
+
+// NewPrivacyView load the privacy settings of users, and the friends and blocks between viewer and them
+func NewPrivacyView(viewerId uint, usersId []uint) *PrivacyView {
+	return &PrivacyView{
+		viewerId: viewerId,
+		settings: GetPrivacySettings(usersId),
+		friends:  FindFriends(viewerId, usersId),
+		blocked:  BlockedEither(viewerId, usersId),
+	}
+}
+
+// CanSee check if the viewer can see the data of owner chosen by field, like func(s PrivacySetting) int { return s.ShowPhone }
+func (v *PrivacyView) CanSee(ownerId uint, field func(s PrivacySetting) int) bool {
+	setting, ok := v.settings[ownerId]
+	if !ok {
+		setting = PrivacySetting{UserId: ownerId}
+	}
+	return Visible(field(setting), ownerId == v.viewerId, v.friends[ownerId], v.blocked[ownerId])
+}
+
+// Hide clear the avatar, phone and email of user which can not be seen by the viewer, user is a copy
+func (v *PrivacyView) Hide(user UserBasic) UserBasic {
+	if !v.CanSee(user.ID, func(s PrivacySetting) int { return s.ShowAvatar }) {
+		user.Avatar = ""
+	}
+	if !v.CanSee(user.ID, func(s PrivacySetting) int { return s.ShowPhone }) {
+		user.Phone = ""
+	}
+	if !v.CanSee(user.ID, func(s PrivacySetting) int { return s.ShowEmail }) {
+		user.Email = ""
+	}
+	return user
+}
+
+// Presence return the online status and last seen time of user, both are empty if the viewer can not see them
+func (v *PrivacyView) Presence(user *UserBasic) (bool, *time.Time) {
+	if !v.CanSee(user.ID, func(s PrivacySetting) int { return s.OnlineStatus }) {
+		return false, nil
+	}
+	if IsOnline(user.ID) {
+		return true, nil
+	}
+	return false, user.LoginOutTime
+}
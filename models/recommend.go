@@ -0,0 +1,155 @@
+package models
+
+import (
+	"HiChat/global"
+	"context"
+	"fmt"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+	"strconv"
+	"time"
+)
+
+// Recommendation is a user the owner may know
+/*
+the params are:
+	* UserId: the recommended user
+	* MutualFriends: the number of friends in common
+	* SharedGroups: the number of communities both joined in
+	* Score: the rank of recommendation, see RecommendScore
+*/
+type Recommendation struct {
+	UserId        uint    `json:"userId"`
+	MutualFriends int64   `json:"mutualFriends"`
+	SharedGroups  int64   `json:"sharedGroups"`
+	Score         float64 `json:"score"`
+}
+
+// the params of recommendation store
+const (
+	// RecommendRefreshInterval how long the recommendations are fresh before computed again
+	RecommendRefreshInterval = time.Hour
+	// RecommendKeepDuration how long the stale recommendations are still served until they are computed again
+	RecommendKeepDuration = 24 * time.Hour
+	// RecommendRefreshBatch the max number of users computed again in one round of refresher
+	RecommendRefreshBatch = 50
+	// MaxRecommendations the max number of recommendations kept for a user
+	MaxRecommendations = 200
+)
+
+// RecommendScore rank the candidate, a mutual friend weighs more than a shared group
+func RecommendScore(mutualFriends int64, sharedGroups int64) float64 {
+	return float64(mutualFriends*3 + sharedGroups)
+}
+
+// the keys of recommendation store, the mark key exists while the store is fresh even if it is empty
+func recommendKey(userId uint) string {
+	return fmt.Sprintf("recommend_%d", userId)
+}
+
+func recommendDetailKey(userId uint) string {
+	return fmt.Sprintf("recommend_detail_%d", userId)
+}
+
+func recommendMarkKey(userId uint) string {
+	return fmt.Sprintf("recommend_at_%d", userId)
+}
+
+// the set of users whose recommendations should be computed again by the refresher
+const recommendRefreshKey = "recommend_refresh"
+
+// IsRecommendationFresh check if the recommendations of user are cached and not expired
+func IsRecommendationFresh(userId uint) bool {
+	n, err := global.RedisDB.Exists(context.Background(), recommendMarkKey(userId)).Result()
+	return err == nil && n > 0
+}
+
+// SaveRecommendations replace the cached recommendations of user
+/* they are fresh for RecommendRefreshInterval, and kept for RecommendKeepDuration to be served while refreshing */
+func SaveRecommendations(userId uint, recommendations []Recommendation) error {
+	ctx := context.Background()
+	pipe := global.RedisDB.TxPipeline()
+	pipe.Del(ctx, recommendKey(userId), recommendDetailKey(userId))
+	for _, r := range recommendations {
+		member := strconv.FormatUint(uint64(r.UserId), 10)
+		pipe.ZAdd(ctx, recommendKey(userId), redis.Z{Score: r.Score, Member: member})
+		pipe.HSet(ctx, recommendDetailKey(userId), member, fmt.Sprintf("%d,%d", r.MutualFriends, r.SharedGroups))
+	}
+	pipe.Expire(ctx, recommendKey(userId), RecommendKeepDuration)
+	pipe.Expire(ctx, recommendDetailKey(userId), RecommendKeepDuration)
+	pipe.Set(ctx, recommendMarkKey(userId), time.Now().Unix(), RecommendRefreshInterval)
+	if _, err := pipe.Exec(ctx); err != nil {
+		zap.S().Info("Failed to save recommendations")
+		return err
+	}
+	return nil
+}
+
+// GetRecommendations return a page of cached recommendations ordered by score, and the total number
+func GetRecommendations(userId uint, offset int64, size int64) ([]Recommendation, int64, error) {
+	ctx := context.Background()
+	total, err := global.RedisDB.ZCard(ctx, recommendKey(userId)).Result()
+	if err != nil {
+		zap.S().Info("Failed to get recommendations")
+		return nil, 0, err
+	}
+	items, err := global.RedisDB.ZRevRangeWithScores(ctx, recommendKey(userId), offset, offset+size-1).Result()
+	if err != nil {
+		zap.S().Info("Failed to get recommendations")
+		return nil, 0, err
+	}
+	recommendations := make([]Recommendation, 0, len(items))
+	for _, item := range items {
+		member, _ := item.Member.(string)
+		id, _ := strconv.ParseUint(member, 10, 64)
+		r := Recommendation{UserId: uint(id), Score: item.Score}
+		if detail, err := global.RedisDB.HGet(ctx, recommendDetailKey(userId), member).Result(); err == nil {
+			fmt.Sscanf(detail, "%d,%d", &r.MutualFriends, &r.SharedGroups)
+		}
+		recommendations = append(recommendations, r)
+	}
+	return recommendations, total, nil
+}
+
+// InvalidateRecommendations remove the cached recommendations of users and ask the refresher to compute them again
+func InvalidateRecommendations(usersId ...uint) {
+	if len(usersId) == 0 {
+		return
+	}
+	ctx := context.Background()
+	keys := make([]string, 0, len(usersId)*3)
+	members := make([]interface{}, 0, len(usersId))
+	for _, id := range usersId {
+		keys = append(keys, recommendKey(id), recommendDetailKey(id), recommendMarkKey(id))
+		members = append(members, id)
+	}
+	pipe := global.RedisDB.TxPipeline()
+	pipe.Del(ctx, keys...)
+	pipe.SAdd(ctx, recommendRefreshKey, members...)
+	if _, err := pipe.Exec(ctx); err != nil {
+		zap.S().Info("Failed to invalidate recommendations")
+	}
+}
+
+// RequestRecommendRefresh ask the refresher to compute the recommendations of user again, the cached ones are kept
+func RequestRecommendRefresh(userId uint) {
+	if err := global.RedisDB.SAdd(context.Background(), recommendRefreshKey, userId).Err(); err != nil {
+		zap.S().Info("Failed to request recommendation refresh")
+	}
+}
+
+// PopRecommendRefresh take at most RecommendRefreshBatch users waiting for refresh
+func PopRecommendRefresh() []uint {
+	members, err := global.RedisDB.SPopN(context.Background(), recommendRefreshKey, RecommendRefreshBatch).Result()
+	if err != nil && err != redis.Nil {
+		zap.S().Info("Failed to get users waiting for refresh")
+		return nil
+	}
+	usersId := make([]uint, 0, len(members))
+	for _, m := range members {
+		if id, err := strconv.ParseUint(m, 10, 64); err == nil {
+			usersId = append(usersId, uint(id))
+		}
+	}
+	return usersId
+}
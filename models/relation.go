@@ -1,21 +1,33 @@
 package models
 
-import "gorm.io/gorm"
+import (
+	"gorm.io/gorm"
+	"time"
+)
 
 // Relation describes the relations between users
 /*
 the params are:
 	* OwnerId is the user id of the relationship owner
-	* TargetId is the user id of the target user when Type = 1; and is the group id of the community if Type = 2
-	* Type = 1 means Friends relationship; while Type = 2 means Group relationship
+	* TargetId is the user id of the target user when Type = 1, 3 or 4; and is the group id of the community if Type = 2
+	* Type = 1 means Friends relationship; Type = 2 means Group relationship; Type = 3 means the owner blocked the target user;
+		Type = 4 means the owner follows the target broadcast account(see BroadcastAccount)
 	* Desc store the description message
+	* Role is the role of member when Type = 2, RoleMember or RoleAdmin; the owner is decided by Community.OwnerId
+	* MutedUntil is the time until which the member cannot post in group when Type = 2, nil means not muted
+	* Alias is the private remark of friend when Type = 1, only visible to the owner
+	* CategoryId is the ContactCategory of friend when Type = 1, 0 means uncategorized
 */
 type Relation struct {
 	gorm.Model
-	OwnerId  uint
-	TargetId uint
-	Type     int
-	Desc     string
+	OwnerId    uint
+	TargetId   uint
+	Type       int
+	Desc       string
+	Role       int
+	MutedUntil *time.Time
+	Alias      string
+	CategoryId uint
 }
 
 func (r *Relation) RelTableName() string {
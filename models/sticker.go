@@ -0,0 +1,80 @@
+package models
+
+import (
+	"HiChat/global"
+	"errors"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// StickerPack describes a pack of custom emoji/stickers
+/*
+the params are:
+	* Name: the name of pack
+	* OwnerId: the userId of pack creator, only the creator can upload stickers into the pack
+	* CommunityId: the id of community if the pack is group-scoped, 0 means a user pack
+	* Cover: the url of pack cover
+	* Desc: describe of pack
+*/
+type StickerPack struct {
+	gorm.Model
+	Name        string
+	OwnerId     uint
+	CommunityId uint
+	Cover       string
+	Desc        string
+}
+
+// StickerItem describes a sticker in pack
+/*
+the params are:
+	* PackId: the id of StickerPack
+	* Name: the short name of sticker, used as plain-text fallback
+	* Url: the url of uploaded sticker file
+*/
+type StickerItem struct {
+	gorm.Model
+	PackId uint
+	Name   string
+	Url    string
+}
+
+// StickerInstall records the packs that user has installed
+type StickerInstall struct {
+	gorm.Model
+	UserId uint
+	PackId uint
+}
+
+// FindStickerForMessage find the sticker referenced by message, and check if the sender can use it
+/*
+* user pack can be used if sender has installed it
+* group-scoped pack can only be used inside its community
+ */
+func FindStickerForMessage(msg *Message) (*StickerItem, error) {
+	item := StickerItem{}
+	if tx := global.DB.Where("id = ?", msg.StickerId).First(&item); tx.RowsAffected == 0 {
+		zap.S().Info("Sticker is not exist")
+		return nil, errors.New("sticker is not exist")
+	}
+	pack := StickerPack{}
+	if tx := global.DB.Where("id = ?", item.PackId).First(&pack); tx.RowsAffected == 0 {
+		zap.S().Info("Sticker Pack is not exist")
+		return nil, errors.New("sticker pack is not exist")
+	}
+
+	if pack.CommunityId != 0 {
+		if msg.Type != 2 || msg.TargetId != pack.CommunityId {
+			zap.S().Info("Group sticker used outside its community")
+			return nil, errors.New("group sticker can only be used inside its community")
+		}
+		return &item, nil
+	}
+
+	install := StickerInstall{}
+	if tx := global.DB.Where("user_id = ? and pack_id = ?", msg.FromId, pack.ID).First(&install); tx.RowsAffected == 0 {
+		zap.S().Info("Sticker Pack is not installed")
+		return nil, errors.New("sticker pack is not installed")
+	}
+	return &item, nil
+}
@@ -0,0 +1,35 @@
+package models
+
+import (
+	"gorm.io/gorm"
+	"time"
+)
+
+// OwnershipTransfer records a request of transferring the ownership of group, which should be accepted by the target
+/*
+the params are:
+	* CommunityId: the id of community
+	* FromId: the owner who started the transfer
+	* ToId: the member who will become the owner
+	* Status: status of transfer, see the Transfer constants
+	* ExpiredAt: the transfer cannot be accepted after it
+*/
+type OwnershipTransfer struct {
+	gorm.Model
+	CommunityId uint
+	FromId      uint
+	ToId        uint
+	Status      int
+	ExpiredAt   time.Time
+}
+
+// the status of OwnershipTransfer
+const (
+	TransferPending   = 0
+	TransferAccepted  = 1
+	TransferDeclined  = 2
+	TransferCancelled = 3
+)
+
+// TransferExpiration how long a transfer waits for acceptance
+const TransferExpiration = 7 * 24 * time.Hour
@@ -1,6 +1,9 @@
 package models
 
 import (
+	"HiChat/common"
+	"errors"
+	"go.uber.org/zap"
 	"gorm.io/gorm"
 
 	"time"
@@ -17,6 +20,7 @@ type Model struct {
 // UserBasic Basic User model
 type UserBasic struct {
 	Model
+	PublicId      string `gorm:"index;type:varchar(16)"` // user-visible id, see common.GenerateId
 	Name          string
 	PassWord      string
 	Avatar        string // profile photo
@@ -32,9 +36,20 @@ type UserBasic struct {
 	LoginOutTime  *time.Time `gorm:"column:login_out_time"`
 	IsLoginOut    bool
 	DeviceInfo    string // the device of login in
+	PhoneHash     string `gorm:"index;type:varchar(64)" json:"-"` // see common.HashContact, used in contact matching
+	EmailHash     string `gorm:"index;type:varchar(64)" json:"-"`
 }
 
 // UserTableName 返回用户表的名字
 func (b *UserBasic) UserTableName() string {
 	return "user_basic"
 }
+
+// AfterCreate Hook function, generate user-visible id by ID
+func (b *UserBasic) AfterCreate(tx *gorm.DB) error {
+	if t := tx.Model(b).Update("public_id", common.GenerateId(common.UserIdPrefix, b.ID)); t.RowsAffected == 0 {
+		zap.S().Info("failed to add public id")
+		return errors.New("failed to add public id")
+	}
+	return nil
+}
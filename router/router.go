@@ -4,6 +4,7 @@ import (
 	"HiChat/middleware"
 	"HiChat/service"
 	"github.com/gin-gonic/gin"
+	"time"
 )
 
 func Router() *gin.Engine {
@@ -26,6 +27,10 @@ func Router() *gin.Engine {
 		user.POST("/new", service.UserRegister)
 		user.POST("/update", middleware.Authentication(), service.UpdateUserInformation)
 		user.DELETE("/delete", middleware.Authentication(), service.DeleteUser)
+		user.GET("/search", middleware.Authentication(), middleware.RateLimit("user_search", 30, time.Minute), service.SearchUser)
+		user.POST("/privacy", middleware.Authentication(), service.UpdatePrivacySetting)
+		user.POST("/profile", middleware.Authentication(), service.UserProfile)
+		user.POST("/broadcast", middleware.Authentication(), service.SetBroadcastAccount)
 	}
 
 	// Relation Module
@@ -34,16 +39,63 @@ func Router() *gin.Engine {
 		// Friends API
 		relation.POST("/list", service.FriendList)
 		relation.POST("/add", service.AddFriendByName)
+		relation.POST("/friend-requests", service.FriendRequestList)
+		relation.POST("/friend-accept", service.AcceptFriendRequest)
+		relation.POST("/friend-reject", service.RejectFriendRequest)
+		relation.POST("/friend-ignore", service.IgnoreFriendRequest)
+		relation.POST("/block", service.BlockUser)
+		relation.POST("/unblock", service.UnblockUser)
+		relation.POST("/block-list", service.BlockList)
+		relation.POST("/follow", service.Follow)
+		relation.POST("/unfollow", service.Unfollow)
+		relation.POST("/followers", service.FollowerList)
+		relation.POST("/following", service.FollowingList)
+		relation.POST("/recommend", service.RecommendList)
 		relation.POST("/update", service.UpdateRelation)
 		relation.DELETE("/delete", service.DelFriendByName)
+		relation.POST("/category", service.CreateCategory)
+		relation.POST("/categories", service.CategoryList)
+		relation.DELETE("/category", service.DeleteCategory)
+		relation.POST("/contacts", middleware.RateLimit("contact_import", 10, time.Hour), service.ImportContacts)
+		relation.DELETE("/contacts", service.ClearContacts)
 
 		// Group API
 		relation.POST("/group_list", service.GetGroupList)
 		relation.POST("/new", service.CreateGroup)
 		relation.GET("/search", service.SearchGroup)
+		relation.GET("/directory", service.GroupDirectory)
+		relation.POST("/visibility", service.SetGroupVisibility)
 		relation.POST("/join", service.JoinGroup)
 		relation.POST("/update-group", service.UpdateGroup)
 		relation.DELETE("/delete-group", service.DelGroup)
+		relation.POST("/deleted-groups", service.DeletedGroupList)
+		relation.POST("/restore-group", service.RestoreGroup)
+		relation.POST("/promote", service.PromoteMember)
+		relation.POST("/demote", service.DemoteMember)
+		relation.POST("/members", service.MemberList)
+		relation.POST("/kick", service.KickMember)
+		relation.POST("/ban", service.BanMember)
+		relation.POST("/unban", service.UnbanMember)
+		relation.POST("/mute", service.MuteMember)
+		relation.POST("/join-policy", service.SetJoinPolicy)
+		relation.POST("/flood-control", service.SetFloodControl)
+		relation.POST("/join-requests", service.JoinRequestList)
+		relation.POST("/join-approve", service.ApproveJoinRequest)
+		relation.POST("/join-reject", service.RejectJoinRequest)
+		relation.POST("/invite-link", service.CreateInviteLink)
+		relation.DELETE("/invite-link", service.RevokeInviteLink)
+		relation.POST("/join-by-link", service.JoinGroupByLink)
+		relation.POST("/invite", service.InviteMember)
+		relation.POST("/transfer", service.TransferOwnership)
+		relation.POST("/transfer-list", service.TransferList)
+		relation.POST("/transfer-accept", service.AcceptTransfer)
+		relation.POST("/transfer-decline", service.DeclineTransfer)
+		relation.DELETE("/transfer", service.CancelTransfer)
+		relation.POST("/audit-log", service.AuditLogList)
+		relation.POST("/channel", service.CreateChannel)
+		relation.POST("/update-channel", service.UpdateChannel)
+		relation.DELETE("/channel", service.DeleteChannel)
+		relation.POST("/channels", service.ChannelList)
 	}
 
 	// Message Module
@@ -51,6 +103,25 @@ func Router() *gin.Engine {
 	{
 		message.POST("/get-records", service.RedisMsg)
 		message.GET("/send", service.SendMsg)
+		message.POST("/live-location", service.LiveLocations)
+		message.POST("/group-call", service.GroupCallParticipants)
+		message.POST("/channel-records", service.ChannelRecords)
+		message.POST("/channel-pins", service.ChannelPins)
+		message.POST("/channel-read", service.ReadChannel)
+		message.POST("/conversations", service.ConversationList)
+		message.POST("/conversation", service.UpdateConversation)
+		message.POST("/conversation-read", service.ReadConversation)
+		message.POST("/feed", service.FeedRecords)
+	}
+
+	// Sticker Module
+	sticker := v1.Group("sticker").Use(middleware.Authentication())
+	{
+		sticker.POST("/list", service.StickerPackList)
+		sticker.POST("/new", service.CreateStickerPack)
+		sticker.POST("/upload", service.UploadSticker)
+		sticker.POST("/install", service.InstallStickerPack)
+		sticker.DELETE("/remove", service.RemoveStickerPack)
 	}
 
 	// File Upload Module
@@ -2,6 +2,7 @@ package service
 
 import (
 	"HiChat/common"
+	"errors"
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
@@ -14,14 +15,25 @@ import (
 )
 
 func UploadFile(ctx *gin.Context) {
-	req := ctx.Request
+	url, err := saveUploadFile(ctx.Request)
+	if err != nil {
+		zap.S().Info(err.Error())
+		common.SendErrorResp(ctx.Writer, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	data := make(map[string]string, 0)
+	data["url"] = url
+	common.SendNormalResp(ctx.Writer, "Success to Upload File", data, nil, 0)
+}
 
+// saveUploadFile store the file of form field "file" in Project Server and return its url
+func saveUploadFile(req *http.Request) (string, error) {
 	// Get File
 	srcFile, head, err := req.FormFile("file")
 	if err != nil {
 		zap.S().Info("Failed to Get File")
-		common.SendErrorResp(ctx.Writer, http.StatusBadRequest, "failed to get file", nil)
-		return
+		return "", errors.New("failed to get file")
 	}
 
 	// Get File Suffix
@@ -32,8 +44,7 @@ func UploadFile(ctx *gin.Context) {
 		suffix = "." + terms[len(terms)-1]
 	} else {
 		zap.S().Info("Failed to get suffix")
-		common.SendErrorResp(ctx.Writer, http.StatusBadRequest, "Cannot get suffix", nil)
-		return
+		return "", errors.New("cannot get suffix")
 	}
 
 	// Store the File in Project Server
@@ -41,16 +52,11 @@ func UploadFile(ctx *gin.Context) {
 	dstFile, err := os.Create("./src/asset/upload" + newFileName)
 	if err != nil {
 		zap.S().Info("Failed to Create new File")
-		common.SendErrorResp(ctx.Writer, http.StatusBadRequest, "failed to store file", nil)
-		return
+		return "", errors.New("failed to store file")
 	}
 	if _, err = io.Copy(dstFile, srcFile); err != nil {
 		zap.S().Info("Failed to Create new File")
-		common.SendErrorResp(ctx.Writer, http.StatusBadRequest, "failed to store file", nil)
-		return
+		return "", errors.New("failed to store file")
 	}
-
-	data := make(map[string]string, 0)
-	data["url"] = "./src/asset/upload" + newFileName
-	common.SendNormalResp(ctx.Writer, "Success to Upload File", data, nil, 0)
+	return "./src/asset/upload" + newFileName, nil
 }
@@ -0,0 +1,78 @@
+package service
+
+import (
+	"HiChat/common"
+	"HiChat/dao"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"net/http"
+	"strconv"
+)
+
+// BlockUser add a user into the block list
+func BlockUser(ctx *gin.Context) {
+	ownerId, targetId, ok := getBlockParams(ctx)
+	if !ok {
+		return
+	}
+	if err := dao.BlockUser(ownerId, targetId); err != nil {
+		zap.S().Info(err.Error())
+		common.SendErrorResp(ctx.Writer, http.StatusInternalServerError, err.Error(), nil)
+		return
+	}
+	common.SendNormalResp(ctx.Writer, "Successfully block user!", nil, nil, 0)
+}
+
+// UnblockUser remove a user from the block list
+func UnblockUser(ctx *gin.Context) {
+	ownerId, targetId, ok := getBlockParams(ctx)
+	if !ok {
+		return
+	}
+	if err := dao.UnblockUser(ownerId, targetId); err != nil {
+		zap.S().Info(err.Error())
+		common.SendErrorResp(ctx.Writer, http.StatusInternalServerError, err.Error(), nil)
+		return
+	}
+	common.SendNormalResp(ctx.Writer, "Successfully unblock user!", nil, nil, 0)
+}
+
+// BlockList return the users blocked by user
+func BlockList(ctx *gin.Context) {
+	ownerId, err := strconv.Atoi(ctx.Query("userId"))
+	if err != nil {
+		zap.S().Info(err.Error())
+		errMsg := "Failed to Get OwnerId"
+		common.SendErrorResp(ctx.Writer, http.StatusInternalServerError, errMsg, nil)
+		return
+	}
+	users, err := dao.GetBlockList(uint(ownerId))
+	if err != nil {
+		zap.S().Info(err.Error())
+		common.SendErrorResp(ctx.Writer, http.StatusInternalServerError, err.Error(), nil)
+		return
+	}
+	blocked := make([]user, 0, len(users))
+	for _, u := range users {
+		blocked = append(blocked, user{ID: u.ID, PublicId: u.PublicId, Name: u.Name, Avatar: u.Avatar})
+	}
+	common.SendNormalResp(ctx.Writer, "Successfully find block list!", nil, blocked, len(blocked))
+}
+
+func getBlockParams(ctx *gin.Context) (uint, uint, bool) {
+	ownerId, err := strconv.Atoi(ctx.Query("userId"))
+	if err != nil {
+		zap.S().Info(err.Error())
+		errMsg := "Failed to Get OwnerId"
+		common.SendErrorResp(ctx.Writer, http.StatusInternalServerError, errMsg, nil)
+		return 0, 0, false
+	}
+	targetId, err := strconv.Atoi(ctx.PostForm("target_id"))
+	if err != nil {
+		zap.S().Info("Don't have necessary params")
+		errMsg := "please add necessary params: target_id"
+		common.SendErrorResp(ctx.Writer, http.StatusBadRequest, errMsg, nil)
+		return 0, 0, false
+	}
+	return uint(ownerId), uint(targetId), true
+}
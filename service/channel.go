@@ -0,0 +1,192 @@
+package service
+
+import (
+	"HiChat/common"
+	"HiChat/dao"
+	"HiChat/models"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"net/http"
+	"strconv"
+)
+
+// getChannelParams return the user id, group id and channel id of request
+func getChannelParams(ctx *gin.Context) (uint, string, uint, bool) {
+	userId, err := strconv.Atoi(ctx.Query("userId"))
+	if err != nil {
+		zap.S().Info(err.Error())
+		errMsg := "Failed to Get UserId"
+		common.SendErrorResp(ctx.Writer, http.StatusInternalServerError, errMsg, nil)
+		return 0, "", 0, false
+	}
+	gid := ctx.PostForm("group_id")
+	channelId, err := strconv.Atoi(ctx.PostForm("channel_id"))
+	if gid == "" || err != nil || channelId <= 0 {
+		zap.S().Info("Don't have necessary params")
+		errMsg := "please add necessary params: group_id, channel_id"
+		common.SendErrorResp(ctx.Writer, http.StatusBadRequest, errMsg, nil)
+		return 0, "", 0, false
+	}
+	return uint(userId), gid, uint(channelId), true
+}
+
+// CreateChannel create a named channel in group
+func CreateChannel(ctx *gin.Context) {
+	userId, err := strconv.Atoi(ctx.Query("userId"))
+	if err != nil {
+		zap.S().Info(err.Error())
+		errMsg := "Failed to Get UserId"
+		common.SendErrorResp(ctx.Writer, http.StatusInternalServerError, errMsg, nil)
+		return
+	}
+	gid := ctx.PostForm("group_id")
+	name := ctx.PostForm("name")
+	if gid == "" || name == "" {
+		zap.S().Info("Don't have necessary params")
+		errMsg := "please add necessary params: group_id, name"
+		common.SendErrorResp(ctx.Writer, http.StatusBadRequest, errMsg, nil)
+		return
+	}
+	postRole, _ := strconv.Atoi(ctx.PostForm("post_role"))
+	channel := models.GroupChannel{
+		Name:     name,
+		Topic:    ctx.PostForm("topic"),
+		PostRole: postRole,
+	}
+	cur, err := dao.CreateChannel(uint(userId), gid, channel)
+	if err != nil {
+		zap.S().Info(err.Error())
+		common.SendErrorResp(ctx.Writer, http.StatusInternalServerError, err.Error(), nil)
+		return
+	}
+	common.SendNormalResp(ctx.Writer, "Successfully create channel!", nil, cur, 1)
+}
+
+// UpdateChannel update the name, topic and post role of channel
+func UpdateChannel(ctx *gin.Context) {
+	userId, gid, channelId, ok := getChannelParams(ctx)
+	if !ok {
+		return
+	}
+	// post_role is only changed when it is given
+	var postRole *int
+	if str, ok := ctx.GetPostForm("post_role"); ok {
+		role, err := strconv.Atoi(str)
+		if err != nil {
+			zap.S().Info("Invalid post role")
+			common.SendErrorResp(ctx.Writer, http.StatusBadRequest, "Failed to Get post_role", nil)
+			return
+		}
+		postRole = &role
+	}
+	channel := models.GroupChannel{
+		Name:  ctx.PostForm("name"),
+		Topic: ctx.PostForm("topic"),
+	}
+	channel.ID = channelId
+	cur, err := dao.UpdateChannel(userId, gid, channel, postRole)
+	if err != nil {
+		zap.S().Info(err.Error())
+		common.SendErrorResp(ctx.Writer, http.StatusInternalServerError, err.Error(), nil)
+		return
+	}
+	common.SendNormalResp(ctx.Writer, "Successfully update channel!", nil, cur, 1)
+}
+
+// DeleteChannel delete the channel with its records
+func DeleteChannel(ctx *gin.Context) {
+	userId, gid, channelId, ok := getChannelParams(ctx)
+	if !ok {
+		return
+	}
+	if err := dao.DeleteChannel(userId, gid, channelId); err != nil {
+		zap.S().Info(err.Error())
+		common.SendErrorResp(ctx.Writer, http.StatusInternalServerError, err.Error(), nil)
+		return
+	}
+	common.SendNormalResp(ctx.Writer, "Successfully delete channel!", nil, nil, 0)
+}
+
+// ChannelList return the channels of group with unread counters
+func ChannelList(ctx *gin.Context) {
+	userId, err := strconv.Atoi(ctx.Query("userId"))
+	if err != nil {
+		zap.S().Info(err.Error())
+		errMsg := "Failed to Get UserId"
+		common.SendErrorResp(ctx.Writer, http.StatusInternalServerError, errMsg, nil)
+		return
+	}
+	gid := ctx.PostForm("group_id")
+	if gid == "" {
+		zap.S().Info("Don't have necessary params")
+		errMsg := "please add necessary params: group_id"
+		common.SendErrorResp(ctx.Writer, http.StatusBadRequest, errMsg, nil)
+		return
+	}
+	channels, err := dao.GetChannels(uint(userId), gid)
+	if err != nil {
+		zap.S().Info(err.Error())
+		common.SendErrorResp(ctx.Writer, http.StatusInternalServerError, err.Error(), nil)
+		return
+	}
+	common.SendNormalResp(ctx.Writer, "Successfully find channels!", nil, channels, len(channels))
+}
+
+// ChannelRecords Get message of channel from Redis
+func ChannelRecords(ctx *gin.Context) {
+	userId, gid, channelId, ok := getChannelParams(ctx)
+	if !ok {
+		return
+	}
+	group, err := dao.CheckChannelAccess(userId, gid, channelId)
+	if err != nil {
+		common.SendErrorResp(ctx.Writer, http.StatusForbidden, err.Error(), nil)
+		return
+	}
+	start, _ := strconv.Atoi(ctx.PostForm("start"))
+	end, _ := strconv.Atoi(ctx.PostForm("end"))
+	isRev, _ := strconv.ParseBool(ctx.PostForm("isRev"))
+	res := models.GetChannelMsgFromRedis(group.ID, channelId, int64(start), int64(end), isRev)
+	if res == nil {
+		common.SendErrorResp(ctx.Writer, http.StatusInternalServerError, "Failed to get records", nil)
+	} else {
+		common.SendNormalResp(ctx.Writer, "Success to get records", nil, res, len(res))
+	}
+}
+
+// ChannelPins Get the pinned messages of channel
+func ChannelPins(ctx *gin.Context) {
+	userId, gid, channelId, ok := getChannelParams(ctx)
+	if !ok {
+		return
+	}
+	group, err := dao.CheckChannelAccess(userId, gid, channelId)
+	if err != nil {
+		common.SendErrorResp(ctx.Writer, http.StatusForbidden, err.Error(), nil)
+		return
+	}
+	pins, err := models.GetChannelPins(group.ID, channelId)
+	if err != nil {
+		common.SendErrorResp(ctx.Writer, http.StatusInternalServerError, err.Error(), nil)
+		return
+	}
+	common.SendNormalResp(ctx.Writer, "Success to get pinned messages", nil, pins, len(pins))
+}
+
+// ReadChannel mark all messages of channel as read
+func ReadChannel(ctx *gin.Context) {
+	userId, gid, channelId, ok := getChannelParams(ctx)
+	if !ok {
+		return
+	}
+	group, err := dao.CheckChannelAccess(userId, gid, channelId)
+	if err != nil {
+		common.SendErrorResp(ctx.Writer, http.StatusForbidden, err.Error(), nil)
+		return
+	}
+	if err = models.ClearChannelUnread(userId, group.ID, channelId); err != nil {
+		common.SendErrorResp(ctx.Writer, http.StatusInternalServerError, err.Error(), nil)
+		return
+	}
+	common.SendNormalResp(ctx.Writer, "Success to read channel", nil, nil, 0)
+}
@@ -0,0 +1,123 @@
+package service
+
+import (
+	"HiChat/common"
+	"HiChat/dao"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// CreateCategory create a contact category, such as "Work" or "Family"
+func CreateCategory(ctx *gin.Context) {
+	ownerId, err := strconv.Atoi(ctx.Query("userId"))
+	if err != nil {
+		zap.S().Info(err.Error())
+		errMsg := "Failed to Get OwnerId"
+		common.SendErrorResp(ctx.Writer, http.StatusInternalServerError, errMsg, nil)
+		return
+	}
+	name := ctx.PostForm("name")
+	if name == "" {
+		zap.S().Info("Don't have necessary params")
+		errMsg := "please add necessary params: name"
+		common.SendErrorResp(ctx.Writer, http.StatusBadRequest, errMsg, nil)
+		return
+	}
+	category, err := dao.CreateCategory(uint(ownerId), name)
+	if err != nil {
+		zap.S().Info(err.Error())
+		common.SendErrorResp(ctx.Writer, http.StatusInternalServerError, err.Error(), nil)
+		return
+	}
+	common.SendNormalResp(ctx.Writer, "Successfully create category!", nil, category, 1)
+}
+
+// CategoryList return the contact categories of user
+func CategoryList(ctx *gin.Context) {
+	ownerId, err := strconv.Atoi(ctx.Query("userId"))
+	if err != nil {
+		zap.S().Info(err.Error())
+		errMsg := "Failed to Get OwnerId"
+		common.SendErrorResp(ctx.Writer, http.StatusInternalServerError, errMsg, nil)
+		return
+	}
+	categories, err := dao.GetCategories(uint(ownerId))
+	if err != nil {
+		zap.S().Info(err.Error())
+		common.SendErrorResp(ctx.Writer, http.StatusInternalServerError, err.Error(), nil)
+		return
+	}
+	common.SendNormalResp(ctx.Writer, "Successfully find categories!", nil, *categories, len(*categories))
+}
+
+// DeleteCategory delete a contact category, the friends in it become uncategorized
+func DeleteCategory(ctx *gin.Context) {
+	ownerId, err := strconv.Atoi(ctx.Query("userId"))
+	if err != nil {
+		zap.S().Info(err.Error())
+		errMsg := "Failed to Get OwnerId"
+		common.SendErrorResp(ctx.Writer, http.StatusInternalServerError, errMsg, nil)
+		return
+	}
+	categoryId, err := strconv.Atoi(ctx.PostForm("category_id"))
+	if err != nil {
+		zap.S().Info("Don't have necessary params")
+		errMsg := "please add necessary params: category_id"
+		common.SendErrorResp(ctx.Writer, http.StatusBadRequest, errMsg, nil)
+		return
+	}
+	if err = dao.DeleteCategory(uint(ownerId), uint(categoryId)); err != nil {
+		zap.S().Info(err.Error())
+		common.SendErrorResp(ctx.Writer, http.StatusInternalServerError, err.Error(), nil)
+		return
+	}
+	common.SendNormalResp(ctx.Writer, "Successfully delete category!", nil, nil, 0)
+}
+
+// ImportContacts upload the hashed phones and emails of address book, and return the ones which are HiChat users
+/*
+hashes is a comma separated list of hex encoded SHA-256 of normalized phones(digits with leading "+") and
+lowercase emails, the raw contacts should never be uploaded. If replace is true, the contacts uploaded
+before are removed, otherwise the hashes are added to them.
+*/
+func ImportContacts(ctx *gin.Context) {
+	ownerId, err := strconv.Atoi(ctx.Query("userId"))
+	if err != nil {
+		zap.S().Info(err.Error())
+		errMsg := "Failed to Get OwnerId"
+		common.SendErrorResp(ctx.Writer, http.StatusInternalServerError, errMsg, nil)
+		return
+	}
+	hashes := make([]string, 0)
+	if str := ctx.PostForm("hashes"); str != "" {
+		hashes = strings.Split(str, ",")
+	}
+	replace, _ := strconv.ParseBool(ctx.PostForm("replace"))
+	matches, err := dao.ImportContacts(uint(ownerId), hashes, replace)
+	if err != nil {
+		zap.S().Info(err.Error())
+		common.SendErrorResp(ctx.Writer, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+	common.SendNormalResp(ctx.Writer, "Successfully import contacts!", nil, matches, len(matches))
+}
+
+// ClearContacts remove the uploaded contacts of user
+func ClearContacts(ctx *gin.Context) {
+	ownerId, err := strconv.Atoi(ctx.Query("userId"))
+	if err != nil {
+		zap.S().Info(err.Error())
+		errMsg := "Failed to Get OwnerId"
+		common.SendErrorResp(ctx.Writer, http.StatusInternalServerError, errMsg, nil)
+		return
+	}
+	if err = dao.ClearContacts(uint(ownerId)); err != nil {
+		zap.S().Info(err.Error())
+		common.SendErrorResp(ctx.Writer, http.StatusInternalServerError, err.Error(), nil)
+		return
+	}
+	common.SendNormalResp(ctx.Writer, "Successfully clear contacts!", nil, nil, 0)
+}
@@ -0,0 +1,119 @@
+package service
+
+import (
+	"HiChat/common"
+	"HiChat/dao"
+	"HiChat/models"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// ConversationList return the friend chats and group chats of user with mute, pin, archive and unread status
+/* the archived conversations are returned only if archived is true */
+func ConversationList(ctx *gin.Context) {
+	userId, err := strconv.Atoi(ctx.Query("userId"))
+	if err != nil {
+		zap.S().Info(err.Error())
+		errMsg := "Failed to Get UserId"
+		common.SendErrorResp(ctx.Writer, http.StatusInternalServerError, errMsg, nil)
+		return
+	}
+	archived, _ := strconv.ParseBool(ctx.PostForm("archived"))
+
+	conversations, err := dao.GetConversations(uint(userId), archived)
+	if err != nil {
+		zap.S().Info(err.Error())
+		common.SendErrorResp(ctx.Writer, http.StatusInternalServerError, err.Error(), nil)
+		return
+	}
+	// the avatars of friends are hidden by their privacy settings
+	friendsId := make([]uint, 0)
+	for _, c := range conversations {
+		if c.Type == 1 {
+			friendsId = append(friendsId, c.TargetId)
+		}
+	}
+	view := models.NewPrivacyView(uint(userId), friendsId)
+	for i, c := range conversations {
+		if c.Type == 1 && !view.CanSee(c.TargetId, func(s models.PrivacySetting) int { return s.ShowAvatar }) {
+			conversations[i].Avatar = ""
+		}
+	}
+	common.SendNormalResp(ctx.Writer, "Success to Get Conversation List", nil, conversations, len(conversations))
+}
+
+// getConversationParams get userId, type and target_id of conversation
+func getConversationParams(ctx *gin.Context) (uint, int, uint, bool) {
+	userId, err := strconv.Atoi(ctx.Query("userId"))
+	if err != nil {
+		zap.S().Info(err.Error())
+		errMsg := "Failed to Get UserId"
+		common.SendErrorResp(ctx.Writer, http.StatusInternalServerError, errMsg, nil)
+		return 0, 0, 0, false
+	}
+	chatType, err1 := strconv.Atoi(ctx.PostForm("type"))
+	targetId, err2 := strconv.Atoi(ctx.PostForm("target_id"))
+	if err1 != nil || err2 != nil {
+		zap.S().Info("Don't have necessary params")
+		errMsg := "please add necessary params: type, target_id"
+		common.SendErrorResp(ctx.Writer, http.StatusBadRequest, errMsg, nil)
+		return 0, 0, 0, false
+	}
+	return uint(userId), chatType, uint(targetId), true
+}
+
+// UpdateConversation mute, pin or archive a conversation, the param not sent is not changed
+/* mute is the seconds of mute, 0 means unmute and -1 means mute forever, pin and archive are bool */
+func UpdateConversation(ctx *gin.Context) {
+	userId, chatType, targetId, ok := getConversationParams(ctx)
+	if !ok {
+		return
+	}
+	u := dao.ConversationUpdate{}
+	if str, ok := ctx.GetPostForm("mute"); ok {
+		seconds, err := strconv.Atoi(str)
+		if err != nil || seconds < -1 {
+			zap.S().Info("Invalid mute")
+			common.SendErrorResp(ctx.Writer, http.StatusBadRequest, "Failed to Get mute", nil)
+			return
+		}
+		mute := time.Duration(seconds) * time.Second
+		u.Mute = &mute
+	}
+	for param, field := range map[string]**bool{"pin": &u.Pin, "archive": &u.Archive} {
+		if str, ok := ctx.GetPostForm(param); ok {
+			v, err := strconv.ParseBool(str)
+			if err != nil {
+				zap.S().Info(err.Error())
+				common.SendErrorResp(ctx.Writer, http.StatusBadRequest, "Failed to Get "+param, nil)
+				return
+			}
+			*field = &v
+		}
+	}
+
+	setting, err := dao.UpdateConversationSetting(userId, chatType, targetId, u)
+	if err != nil {
+		zap.S().Info(err.Error())
+		common.SendErrorResp(ctx.Writer, http.StatusInternalServerError, err.Error(), nil)
+		return
+	}
+	common.SendNormalResp(ctx.Writer, "Success to Update Conversation", nil, setting, 1)
+}
+
+// ReadConversation clear the unread counter of conversation
+func ReadConversation(ctx *gin.Context) {
+	userId, chatType, targetId, ok := getConversationParams(ctx)
+	if !ok {
+		return
+	}
+	if err := models.ClearOfflineUnread(userId, chatType, targetId); err != nil {
+		zap.S().Info(err.Error())
+		common.SendErrorResp(ctx.Writer, http.StatusInternalServerError, err.Error(), nil)
+		return
+	}
+	common.SendNormalResp(ctx.Writer, "Success to Read Conversation", nil, nil, 0)
+}
@@ -0,0 +1,47 @@
+package service
+
+import (
+	"HiChat/common"
+	"HiChat/dao"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"net/http"
+	"strconv"
+)
+
+// SetFloodControl change the slow mode seconds, max message length and link restriction hours of group, 0 means no limit
+func SetFloodControl(ctx *gin.Context) {
+	ownerId, err := strconv.Atoi(ctx.Query("userId"))
+	if err != nil {
+		zap.S().Info(err.Error())
+		errMsg := "Failed to Get OwnerId"
+		common.SendErrorResp(ctx.Writer, http.StatusInternalServerError, errMsg, nil)
+		return
+	}
+	gid := ctx.PostForm("group_id")
+	if gid == "" {
+		zap.S().Info("Don't have necessary params")
+		errMsg := "please add necessary params: group_id"
+		common.SendErrorResp(ctx.Writer, http.StatusBadRequest, errMsg, nil)
+		return
+	}
+	params := make([]int, 0, 3)
+	for _, name := range []string{"slow_mode", "max_length", "link_restrict_hours"} {
+		v := 0
+		if str := ctx.PostForm(name); str != "" {
+			if v, err = strconv.Atoi(str); err != nil {
+				zap.S().Info(err.Error())
+				errMsg := "Failed to Get " + name
+				common.SendErrorResp(ctx.Writer, http.StatusBadRequest, errMsg, nil)
+				return
+			}
+		}
+		params = append(params, v)
+	}
+	if err = dao.SetFloodControl(uint(ownerId), gid, params[0], params[1], params[2]); err != nil {
+		zap.S().Info(err.Error())
+		common.SendErrorResp(ctx.Writer, http.StatusInternalServerError, err.Error(), nil)
+		return
+	}
+	common.SendNormalResp(ctx.Writer, "Successfully update flood control!", nil, nil, 0)
+}
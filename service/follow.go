@@ -0,0 +1,153 @@
+package service
+
+import (
+	"HiChat/common"
+	"HiChat/dao"
+	"HiChat/models"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"net/http"
+	"strconv"
+)
+
+// SetBroadcastAccount turn user into a broadcast account which can be followed, or turn it back
+/* enabled and allow_dm are bool, allow_dm lets the users who are not friends send direct messages to account */
+func SetBroadcastAccount(ctx *gin.Context) {
+	userId, err := strconv.Atoi(ctx.Query("userId"))
+	if err != nil {
+		zap.S().Info(err.Error())
+		errMsg := "Failed to Get UserId"
+		common.SendErrorResp(ctx.Writer, http.StatusInternalServerError, errMsg, nil)
+		return
+	}
+	enabled, err := strconv.ParseBool(ctx.PostForm("enabled"))
+	if err != nil {
+		zap.S().Info("Don't have necessary params")
+		errMsg := "please add necessary params: enabled"
+		common.SendErrorResp(ctx.Writer, http.StatusBadRequest, errMsg, nil)
+		return
+	}
+	allowDM, _ := strconv.ParseBool(ctx.PostForm("allow_dm"))
+
+	account, err := dao.SetBroadcastAccount(uint(userId), enabled, allowDM)
+	if err != nil {
+		zap.S().Info(err.Error())
+		common.SendErrorResp(ctx.Writer, http.StatusInternalServerError, err.Error(), nil)
+		return
+	}
+	common.SendNormalResp(ctx.Writer, "Success to Set Broadcast Account", nil, account, 1)
+}
+
+// Follow follow a broadcast account, the posts of account are pushed to followers
+func Follow(ctx *gin.Context) {
+	ownerId, targetId, ok := getBlockParams(ctx)
+	if !ok {
+		return
+	}
+	if err := dao.Follow(ownerId, targetId); err != nil {
+		zap.S().Info(err.Error())
+		common.SendErrorResp(ctx.Writer, http.StatusInternalServerError, err.Error(), nil)
+		return
+	}
+	common.SendNormalResp(ctx.Writer, "Successfully follow account!", nil, nil, 0)
+}
+
+// Unfollow stop following a broadcast account
+func Unfollow(ctx *gin.Context) {
+	ownerId, targetId, ok := getBlockParams(ctx)
+	if !ok {
+		return
+	}
+	if err := dao.Unfollow(ownerId, targetId); err != nil {
+		zap.S().Info(err.Error())
+		common.SendErrorResp(ctx.Writer, http.StatusInternalServerError, err.Error(), nil)
+		return
+	}
+	common.SendNormalResp(ctx.Writer, "Successfully unfollow account!", nil, nil, 0)
+}
+
+// FollowerList return a page of followers of the broadcast account of user, and the total number
+func FollowerList(ctx *gin.Context) {
+	userId, err := strconv.Atoi(ctx.Query("userId"))
+	if err != nil {
+		zap.S().Info(err.Error())
+		errMsg := "Failed to Get UserId"
+		common.SendErrorResp(ctx.Writer, http.StatusInternalServerError, errMsg, nil)
+		return
+	}
+	page, size := getPageParams(ctx)
+
+	users, total, err := dao.GetFollowers(uint(userId), page, size)
+	if err != nil {
+		zap.S().Info(err.Error())
+		common.SendErrorResp(ctx.Writer, http.StatusInternalServerError, err.Error(), nil)
+		return
+	}
+	usersId := make([]uint, 0, len(users))
+	for _, u := range users {
+		usersId = append(usersId, u.ID)
+	}
+	view := models.NewPrivacyView(uint(userId), usersId)
+	followers := make([]user, 0, len(users))
+	for _, u := range users {
+		followers = append(followers, user{ID: u.ID, PublicId: u.PublicId, Name: u.Name, Avatar: view.Hide(*u).Avatar, Gender: u.Gender})
+	}
+
+	data := make(map[string]string)
+	data["total"] = strconv.FormatInt(total, 10)
+	data["page"] = strconv.Itoa(page)
+	common.SendNormalResp(ctx.Writer, "Successfully find followers!", data, followers, len(followers))
+}
+
+// FollowingList return the broadcast accounts followed by user
+func FollowingList(ctx *gin.Context) {
+	userId, err := strconv.Atoi(ctx.Query("userId"))
+	if err != nil {
+		zap.S().Info(err.Error())
+		errMsg := "Failed to Get UserId"
+		common.SendErrorResp(ctx.Writer, http.StatusInternalServerError, errMsg, nil)
+		return
+	}
+	users, err := dao.GetFollowing(uint(userId))
+	if err != nil {
+		zap.S().Info(err.Error())
+		common.SendErrorResp(ctx.Writer, http.StatusInternalServerError, err.Error(), nil)
+		return
+	}
+	accounts := make([]user, 0, len(users))
+	for _, u := range users {
+		accounts = append(accounts, user{ID: u.ID, PublicId: u.PublicId, Name: u.Name, Avatar: u.Avatar})
+	}
+	common.SendNormalResp(ctx.Writer, "Successfully find following accounts!", nil, accounts, len(accounts))
+}
+
+// FeedRecords Get the posts of broadcast account, only for followers and the account itself
+func FeedRecords(ctx *gin.Context) {
+	userId, err := strconv.Atoi(ctx.Query("userId"))
+	if err != nil {
+		zap.S().Info(err.Error())
+		errMsg := "Failed to Get UserId"
+		common.SendErrorResp(ctx.Writer, http.StatusInternalServerError, errMsg, nil)
+		return
+	}
+	accountId, err := strconv.Atoi(ctx.PostForm("account_id"))
+	if err != nil {
+		zap.S().Info("Don't have necessary params")
+		errMsg := "please add necessary params: account_id"
+		common.SendErrorResp(ctx.Writer, http.StatusBadRequest, errMsg, nil)
+		return
+	}
+	if err = dao.CheckFeedAccess(uint(userId), uint(accountId)); err != nil {
+		common.SendErrorResp(ctx.Writer, http.StatusForbidden, err.Error(), nil)
+		return
+	}
+	start, _ := strconv.Atoi(ctx.PostForm("start"))
+	end, _ := strconv.Atoi(ctx.PostForm("end"))
+	isRev, _ := strconv.ParseBool(ctx.PostForm("isRev"))
+	res := models.GetFeedFromRedis(uint(accountId), int64(start), int64(end), isRev)
+	if res == nil {
+		common.SendErrorResp(ctx.Writer, http.StatusInternalServerError, "Failed to get records", nil)
+	} else {
+		common.SendNormalResp(ctx.Writer, "Success to get records", nil, res, len(res))
+	}
+}
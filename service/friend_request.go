@@ -0,0 +1,77 @@
+package service
+
+import (
+	"HiChat/common"
+	"HiChat/dao"
+	"HiChat/models"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"net/http"
+	"strconv"
+)
+
+// FriendRequestList return the pending friend requests of user, direction is incoming(default) or outgoing
+func FriendRequestList(ctx *gin.Context) {
+	ownerId, err := strconv.Atoi(ctx.Query("userId"))
+	if err != nil {
+		zap.S().Info(err.Error())
+		errMsg := "Failed to Get OwnerId"
+		common.SendErrorResp(ctx.Writer, http.StatusInternalServerError, errMsg, nil)
+		return
+	}
+	var incoming bool
+	switch ctx.PostForm("direction") {
+	case "", "incoming":
+		incoming = true
+	case "outgoing":
+	default:
+		errMsg := "direction should be incoming or outgoing"
+		common.SendErrorResp(ctx.Writer, http.StatusBadRequest, errMsg, nil)
+		return
+	}
+	requests, err := dao.GetFriendRequests(uint(ownerId), incoming)
+	if err != nil {
+		zap.S().Info(err.Error())
+		common.SendErrorResp(ctx.Writer, http.StatusInternalServerError, err.Error(), nil)
+		return
+	}
+	common.SendNormalResp(ctx.Writer, "Successfully find friend requests!", nil, *requests, len(*requests))
+}
+
+// AcceptFriendRequest accept a friend request and become friends with the sender
+func AcceptFriendRequest(ctx *gin.Context) {
+	respondFriendRequest(ctx, models.FriendRequestAccepted, "Successfully accept friend request!")
+}
+
+// RejectFriendRequest reject a friend request, the sender is notified
+func RejectFriendRequest(ctx *gin.Context) {
+	respondFriendRequest(ctx, models.FriendRequestRejected, "Successfully reject friend request!")
+}
+
+// IgnoreFriendRequest close a friend request without notifying the sender
+func IgnoreFriendRequest(ctx *gin.Context) {
+	respondFriendRequest(ctx, models.FriendRequestIgnored, "Successfully ignore friend request!")
+}
+
+func respondFriendRequest(ctx *gin.Context, status int, msg string) {
+	ownerId, err := strconv.Atoi(ctx.Query("userId"))
+	if err != nil {
+		zap.S().Info(err.Error())
+		errMsg := "Failed to Get OwnerId"
+		common.SendErrorResp(ctx.Writer, http.StatusInternalServerError, errMsg, nil)
+		return
+	}
+	requestId, err := strconv.Atoi(ctx.PostForm("request_id"))
+	if err != nil {
+		zap.S().Info("Don't have necessary params")
+		errMsg := "please add necessary params: request_id"
+		common.SendErrorResp(ctx.Writer, http.StatusBadRequest, errMsg, nil)
+		return
+	}
+	if err = dao.RespondFriendRequest(uint(ownerId), uint(requestId), status); err != nil {
+		zap.S().Info(err.Error())
+		common.SendErrorResp(ctx.Writer, http.StatusInternalServerError, err.Error(), nil)
+		return
+	}
+	common.SendNormalResp(ctx.Writer, msg, nil, nil, 0)
+}
@@ -0,0 +1,188 @@
+package service
+
+import (
+	"HiChat/common"
+	"HiChat/dao"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// SetJoinPolicy change how users join in the group: 0 open, 1 approval required, 2 invite-only
+func SetJoinPolicy(ctx *gin.Context) {
+	ownerId, err := strconv.Atoi(ctx.Query("userId"))
+	if err != nil {
+		zap.S().Info(err.Error())
+		errMsg := "Failed to Get OwnerId"
+		common.SendErrorResp(ctx.Writer, http.StatusInternalServerError, errMsg, nil)
+		return
+	}
+	gid := ctx.PostForm("group_id")
+	policy, err := strconv.Atoi(ctx.PostForm("join_policy"))
+	if gid == "" || err != nil {
+		zap.S().Info("Don't have necessary params")
+		errMsg := "please add necessary params: group_id, join_policy"
+		common.SendErrorResp(ctx.Writer, http.StatusBadRequest, errMsg, nil)
+		return
+	}
+	if err = dao.SetJoinPolicy(uint(ownerId), gid, policy); err != nil {
+		zap.S().Info(err.Error())
+		common.SendErrorResp(ctx.Writer, http.StatusInternalServerError, err.Error(), nil)
+		return
+	}
+	common.SendNormalResp(ctx.Writer, "Successfully update join policy!", nil, nil, 0)
+}
+
+// JoinRequestList return the pending join requests of group
+func JoinRequestList(ctx *gin.Context) {
+	ownerId, err := strconv.Atoi(ctx.Query("userId"))
+	if err != nil {
+		zap.S().Info(err.Error())
+		errMsg := "Failed to Get OwnerId"
+		common.SendErrorResp(ctx.Writer, http.StatusInternalServerError, errMsg, nil)
+		return
+	}
+	gid := ctx.PostForm("group_id")
+	if gid == "" {
+		zap.S().Info("Don't have necessary params")
+		errMsg := "please add necessary params: group_id"
+		common.SendErrorResp(ctx.Writer, http.StatusBadRequest, errMsg, nil)
+		return
+	}
+	requests, err := dao.GetJoinRequests(uint(ownerId), gid)
+	if err != nil {
+		zap.S().Info(err.Error())
+		common.SendErrorResp(ctx.Writer, http.StatusInternalServerError, err.Error(), nil)
+		return
+	}
+	common.SendNormalResp(ctx.Writer, "Successfully find join requests!", nil, *requests, len(*requests))
+}
+
+// ApproveJoinRequest approve a join request and add the applicant into group
+func ApproveJoinRequest(ctx *gin.Context) {
+	handleJoinRequest(ctx, true, "Successfully approve join request!")
+}
+
+// RejectJoinRequest reject a join request
+func RejectJoinRequest(ctx *gin.Context) {
+	handleJoinRequest(ctx, false, "Successfully reject join request!")
+}
+
+func handleJoinRequest(ctx *gin.Context, approve bool, msg string) {
+	ownerId, err := strconv.Atoi(ctx.Query("userId"))
+	if err != nil {
+		zap.S().Info(err.Error())
+		errMsg := "Failed to Get OwnerId"
+		common.SendErrorResp(ctx.Writer, http.StatusInternalServerError, errMsg, nil)
+		return
+	}
+	requestId, err := strconv.Atoi(ctx.PostForm("request_id"))
+	if err != nil {
+		zap.S().Info("Don't have necessary params")
+		errMsg := "please add necessary params: request_id"
+		common.SendErrorResp(ctx.Writer, http.StatusBadRequest, errMsg, nil)
+		return
+	}
+	if err = dao.HandleJoinRequest(uint(ownerId), uint(requestId), approve); err != nil {
+		zap.S().Info(err.Error())
+		common.SendErrorResp(ctx.Writer, http.StatusInternalServerError, err.Error(), nil)
+		return
+	}
+	common.SendNormalResp(ctx.Writer, msg, nil, nil, 0)
+}
+
+// CreateInviteLink create an invite link of group, max_uses 0 means unlimited and expire(seconds) 0 means never expire
+func CreateInviteLink(ctx *gin.Context) {
+	ownerId, err := strconv.Atoi(ctx.Query("userId"))
+	if err != nil {
+		zap.S().Info(err.Error())
+		errMsg := "Failed to Get OwnerId"
+		common.SendErrorResp(ctx.Writer, http.StatusInternalServerError, errMsg, nil)
+		return
+	}
+	gid := ctx.PostForm("group_id")
+	if gid == "" {
+		zap.S().Info("Don't have necessary params")
+		errMsg := "please add necessary params: group_id"
+		common.SendErrorResp(ctx.Writer, http.StatusBadRequest, errMsg, nil)
+		return
+	}
+	maxUses, _ := strconv.Atoi(ctx.DefaultPostForm("max_uses", "0"))
+	expire, _ := strconv.Atoi(ctx.DefaultPostForm("expire", "0"))
+
+	link, err := dao.CreateInviteLink(uint(ownerId), gid, maxUses, time.Duration(expire)*time.Second)
+	if err != nil {
+		zap.S().Info(err.Error())
+		common.SendErrorResp(ctx.Writer, http.StatusInternalServerError, err.Error(), nil)
+		return
+	}
+	data := make(map[string]string)
+	data["token"] = link.Token
+	common.SendNormalResp(ctx.Writer, "Successfully create invite link!", data, link, 1)
+}
+
+// RevokeInviteLink delete an invite link by token
+func RevokeInviteLink(ctx *gin.Context) {
+	ownerId, err := strconv.Atoi(ctx.Query("userId"))
+	if err != nil {
+		zap.S().Info(err.Error())
+		errMsg := "Failed to Get OwnerId"
+		common.SendErrorResp(ctx.Writer, http.StatusInternalServerError, errMsg, nil)
+		return
+	}
+	token := ctx.PostForm("token")
+	if token == "" {
+		zap.S().Info("Don't have necessary params")
+		errMsg := "please add necessary params: token"
+		common.SendErrorResp(ctx.Writer, http.StatusBadRequest, errMsg, nil)
+		return
+	}
+	if err = dao.RevokeInviteLink(uint(ownerId), token); err != nil {
+		zap.S().Info(err.Error())
+		common.SendErrorResp(ctx.Writer, http.StatusInternalServerError, err.Error(), nil)
+		return
+	}
+	common.SendNormalResp(ctx.Writer, "Successfully revoke invite link!", nil, nil, 0)
+}
+
+// JoinGroupByLink join in group by invite link token
+func JoinGroupByLink(ctx *gin.Context) {
+	ownerId, err := strconv.Atoi(ctx.Query("userId"))
+	if err != nil {
+		zap.S().Info(err.Error())
+		errMsg := "Failed to Get OwnerId"
+		common.SendErrorResp(ctx.Writer, http.StatusInternalServerError, errMsg, nil)
+		return
+	}
+	token := ctx.PostForm("token")
+	if token == "" {
+		zap.S().Info("Don't have necessary params")
+		errMsg := "please add necessary params: token"
+		common.SendErrorResp(ctx.Writer, http.StatusBadRequest, errMsg, nil)
+		return
+	}
+	community, err := dao.JoinInCommunityByLink(uint(ownerId), token)
+	if err != nil {
+		zap.S().Info(err.Error())
+		common.SendErrorResp(ctx.Writer, http.StatusInternalServerError, err.Error(), nil)
+		return
+	}
+	common.SendNormalResp(ctx.Writer, "Successfully join group!", nil, community, 1)
+}
+
+// InviteMember add a user into group directly, which is limited by the privacy setting of the user
+func InviteMember(ctx *gin.Context) {
+	ownerId, gid, targetId, ok := getMemberParams(ctx)
+	if !ok {
+		return
+	}
+	community, err := dao.InviteMember(ownerId, gid, targetId)
+	if err != nil {
+		zap.S().Info(err.Error())
+		common.SendErrorResp(ctx.Writer, http.StatusInternalServerError, err.Error(), nil)
+		return
+	}
+	common.SendNormalResp(ctx.Writer, "Successfully invite member!", nil, community, 1)
+}
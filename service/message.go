@@ -2,6 +2,7 @@ package service
 
 import (
 	"HiChat/common"
+	"HiChat/dao"
 	"HiChat/models"
 	"github.com/gin-gonic/gin"
 	"net/http"
@@ -27,3 +28,36 @@ func RedisMsg(ctx *gin.Context) {
 func SendMsg(ctx *gin.Context) {
 	models.Chat(ctx.Writer, ctx.Request)
 }
+
+// LiveLocations Get the active live locations of friend/group chat
+func LiveLocations(ctx *gin.Context) {
+	userId, _ := strconv.Atoi(ctx.Query("userId"))
+	targetId, _ := strconv.Atoi(ctx.Query("targetId"))
+	tp, _ := strconv.Atoi(ctx.PostForm("type"))
+	if tp == 2 && !dao.IsGroupMember(uint(userId), uint(targetId)) {
+		common.SendErrorResp(ctx.Writer, http.StatusForbidden, "User is not the member of group", nil)
+		return
+	}
+	points, err := models.GetLiveLocations(uint(userId), uint(targetId), tp)
+	if err != nil {
+		common.SendErrorResp(ctx.Writer, http.StatusInternalServerError, err.Error(), nil)
+		return
+	}
+	common.SendNormalResp(ctx.Writer, "Success to get live locations", nil, points, len(points))
+}
+
+// GroupCallParticipants Get the participants of the active call room in group
+func GroupCallParticipants(ctx *gin.Context) {
+	userId, _ := strconv.Atoi(ctx.Query("userId"))
+	targetId, _ := strconv.Atoi(ctx.Query("targetId"))
+	if !dao.IsGroupMember(uint(userId), uint(targetId)) {
+		common.SendErrorResp(ctx.Writer, http.StatusForbidden, "User is not the member of group", nil)
+		return
+	}
+	participants, err := models.GetGroupCallParticipants(uint(targetId))
+	if err != nil {
+		common.SendErrorResp(ctx.Writer, http.StatusInternalServerError, err.Error(), nil)
+		return
+	}
+	common.SendNormalResp(ctx.Writer, "Success to get call participants", nil, participants, len(participants))
+}
@@ -0,0 +1,87 @@
+package service
+
+import (
+	"HiChat/common"
+	"HiChat/dao"
+	"HiChat/models"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// profile is a user with the presence and relationship seen by the viewer
+type profile struct {
+	userStatus
+	dao.RelationContext
+}
+
+// UserProfile return the profiles of users with the relationship to the viewer
+/* ids is a comma-separated list of user ids, at most dao.MaxProfileBatch, the users not exist are skipped */
+func UserProfile(ctx *gin.Context) {
+	userId, err := strconv.Atoi(ctx.Query("userId"))
+	if err != nil {
+		zap.S().Info(err.Error())
+		errMsg := "Failed to Get UserId"
+		common.SendErrorResp(ctx.Writer, http.StatusInternalServerError, errMsg, nil)
+		return
+	}
+	str := ctx.PostForm("ids")
+	if str == "" {
+		zap.S().Info("Don't have necessary params")
+		errMsg := "please add necessary params: ids"
+		common.SendErrorResp(ctx.Writer, http.StatusBadRequest, errMsg, nil)
+		return
+	}
+	usersId := make([]uint, 0)
+	seen := make(map[uint]bool)
+	for _, s := range strings.Split(str, ",") {
+		id, err := strconv.Atoi(strings.TrimSpace(s))
+		if err != nil || id <= 0 {
+			zap.S().Info("Invalid user id")
+			common.SendErrorResp(ctx.Writer, http.StatusBadRequest, "Failed to Get ids", nil)
+			return
+		}
+		if !seen[uint(id)] {
+			seen[uint(id)] = true
+			usersId = append(usersId, uint(id))
+		}
+	}
+	if len(usersId) > dao.MaxProfileBatch {
+		errMsg := "too many users, the max is " + strconv.Itoa(dao.MaxProfileBatch)
+		common.SendErrorResp(ctx.Writer, http.StatusBadRequest, errMsg, nil)
+		return
+	}
+
+	users, err := dao.GetUsersByIds(usersId)
+	if err != nil {
+		zap.S().Info(err.Error())
+		common.SendErrorResp(ctx.Writer, http.StatusInternalServerError, err.Error(), nil)
+		return
+	}
+	contexts, err := dao.GetRelationContexts(uint(userId), usersId)
+	if err != nil {
+		zap.S().Info(err.Error())
+		common.SendErrorResp(ctx.Writer, http.StatusInternalServerError, err.Error(), nil)
+		return
+	}
+	usersMap := make(map[uint]*models.UserBasic, len(users))
+	for _, u := range users {
+		usersMap[u.ID] = u
+	}
+
+	// the profiles are returned in the order of ids
+	view := models.NewPrivacyView(uint(userId), usersId)
+	profiles := make([]profile, 0, len(users))
+	for _, id := range usersId {
+		u, ok := usersMap[id]
+		if !ok {
+			continue
+		}
+		p := profile{userStatus: userStatus{user: newUser(view.Hide(*u))}, RelationContext: *contexts[id]}
+		p.Online, p.LastSeen = view.Presence(u)
+		profiles = append(profiles, p)
+	}
+	common.SendNormalResp(ctx.Writer, "Success to Get User Profile", nil, profiles, len(profiles))
+}
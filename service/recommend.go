@@ -0,0 +1,70 @@
+package service
+
+import (
+	"HiChat/common"
+	"HiChat/dao"
+	"HiChat/models"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"net/http"
+	"strconv"
+)
+
+// a data model that define the recommended user information return to User
+type recommendation struct {
+	user
+	MutualFriends int64
+	SharedGroups  int64
+}
+
+// RecommendList return a page of people the user may know, ranked by mutual friends and shared groups
+func RecommendList(ctx *gin.Context) {
+	userId, err := strconv.Atoi(ctx.Query("userId"))
+	if err != nil {
+		zap.S().Info(err.Error())
+		errMsg := "Failed to Get UserId"
+		common.SendErrorResp(ctx.Writer, http.StatusInternalServerError, errMsg, nil)
+		return
+	}
+	page, size := getPageParams(ctx)
+
+	recommendations, total, err := dao.GetRecommendations(uint(userId), page, size)
+	if err != nil {
+		zap.S().Info(err.Error())
+		common.SendErrorResp(ctx.Writer, http.StatusInternalServerError, err.Error(), nil)
+		return
+	}
+	usersId := make([]uint, 0, len(recommendations))
+	for _, r := range recommendations {
+		usersId = append(usersId, r.UserId)
+	}
+	users, err := dao.GetUsersByIds(usersId)
+	if err != nil {
+		zap.S().Info(err.Error())
+		common.SendErrorResp(ctx.Writer, http.StatusInternalServerError, err.Error(), nil)
+		return
+	}
+	usersMap := make(map[uint]*models.UserBasic)
+	for _, u := range users {
+		usersMap[u.ID] = u
+	}
+
+	view := models.NewPrivacyView(uint(userId), usersId)
+	result := make([]recommendation, 0, len(recommendations))
+	for _, r := range recommendations {
+		u, ok := usersMap[r.UserId]
+		if !ok {
+			continue
+		}
+		result = append(result, recommendation{
+			user:          user{ID: u.ID, PublicId: u.PublicId, Name: u.Name, Avatar: view.Hide(*u).Avatar, Gender: u.Gender},
+			MutualFriends: r.MutualFriends,
+			SharedGroups:  r.SharedGroups,
+		})
+	}
+
+	data := make(map[string]string)
+	data["total"] = strconv.FormatInt(total, 10)
+	data["page"] = strconv.Itoa(page)
+	common.SendNormalResp(ctx.Writer, "Success to Get Recommendations", data, result, len(result))
+}
@@ -8,19 +8,37 @@ import (
 	"go.uber.org/zap"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 )
 
 // a data model that define the User information return to User
 type user struct {
-	ID     uint
-	Name   string
-	Avatar string
-	Gender string
-	Phone  string
-	Email  string
+	ID       uint
+	PublicId string
+	Name     string
+	Avatar   string
+	Gender   string
+	Phone    string
+	Email    string
+}
+
+// newUser return the public fields of user
+func newUser(u models.UserBasic) user {
+	return user{ID: u.ID, PublicId: u.PublicId, Name: u.Name, Avatar: u.Avatar, Gender: u.Gender, Phone: u.Phone, Email: u.Email}
+}
+
+// friend is a friend with the private alias, desc, category and tags of owner
+type friend struct {
+	user
+	Alias      string
+	Desc       string
+	CategoryId uint
+	Tags       []string
 }
 
 // FriendList Get one's friend list by his userID
+/* the list can be filtered by category_id, tag and keyword(prefix of alias or name), and sorted by alias, name or newest */
 func FriendList(ctx *gin.Context) {
 	// try to get user userId
 	userId, err := strconv.Atoi(ctx.Query("userId"))
@@ -30,37 +48,66 @@ func FriendList(ctx *gin.Context) {
 		common.SendErrorResp(ctx.Writer, http.StatusInternalServerError, errMsg, nil)
 		return
 	}
+	q := dao.FriendQuery{
+		Tag:     ctx.PostForm("tag"),
+		Keyword: ctx.PostForm("keyword"),
+		Sort:    ctx.PostForm("sort"),
+	}
+	if str := ctx.PostForm("category_id"); str != "" {
+		categoryId, err := strconv.Atoi(str)
+		if err != nil {
+			zap.S().Info(err.Error())
+			common.SendErrorResp(ctx.Writer, http.StatusBadRequest, "Failed to Get category_id", nil)
+			return
+		}
+		id := uint(categoryId)
+		q.CategoryId = &id
+	}
+
 	// search friend list by userId in DAO
-	friendList, err := dao.GetFriendList(uint(userId))
+	friendList, err := dao.GetFriends(uint(userId), q)
 	if err != nil {
 		zap.S().Info(err.Error())
-		errMsg := "friends list is empty"
-		common.SendErrorResp(ctx.Writer, http.StatusInternalServerError, errMsg, nil)
+		common.SendErrorResp(ctx.Writer, http.StatusInternalServerError, err.Error(), nil)
 		return
 	}
 
-	if friendList == nil {
+	if len(friendList) == 0 {
 		zap.S().Info("User didn't have any friends")
 		common.SendNormalResp(ctx.Writer, "User didn't have any friends", nil, nil, 0)
 		return
 	}
 
-	friends := make([]user, 0)
-	for _, f := range *friendList {
-		friends = append(friends, user{
-			ID:     f.ID,
-			Name:   f.Name,
-			Avatar: f.Avatar,
-			Gender: f.Gender,
-			Phone:  f.Phone,
-			Email:  f.Email,
+	// the avatar, phone and email set visible to nobody are hidden from friends too
+	friendsId := make([]uint, 0, len(friendList))
+	for _, f := range friendList {
+		friendsId = append(friendsId, f.ID)
+	}
+	view := models.NewPrivacyView(uint(userId), friendsId)
+	friends := make([]friend, 0)
+	for _, f := range friendList {
+		friends = append(friends, friend{
+			user: newUser(view.Hide(models.UserBasic{
+				Model:    models.Model{ID: f.ID},
+				PublicId: f.PublicId,
+				Name:     f.Name,
+				Avatar:   f.Avatar,
+				Gender:   f.Gender,
+				Phone:    f.Phone,
+				Email:    f.Email,
+			})),
+			Alias:      f.Alias,
+			Desc:       f.Desc,
+			CategoryId: f.CategoryId,
+			Tags:       f.Tags,
 		})
 	}
 
 	common.SendNormalResp(ctx.Writer, "Success to Get Friend List", nil, friends, len(friends))
 }
 
-// AddFriendByName call DAO to create a relationship between currentUser and targetUser
+// AddFriendByName call DAO to send a friend request from currentUser to targetUser
+/* targetUser is found by targetPublicId or targetName, the relationship is created after targetUser accepts the request */
 func AddFriendByName(ctx *gin.Context) {
 	// try to get ownerId and targetName
 	ownerId, err := strconv.Atoi(ctx.Query("userId"))
@@ -71,16 +118,23 @@ func AddFriendByName(ctx *gin.Context) {
 		return
 	}
 	targetName := ctx.PostForm("targetName")
+	targetPublicId := ctx.PostForm("targetPublicId")
+	greeting := ctx.PostForm("greeting")
 
-	// Add Friend in DAO
-	err = dao.AddFriendByName(uint(ownerId), targetName)
+	// Send Friend Request in DAO, the user-visible id is preferred to the name
+	var msg string
+	if targetPublicId != "" {
+		msg, err = dao.SendFriendRequestByPublicId(uint(ownerId), targetPublicId, greeting)
+	} else {
+		msg, err = dao.SendFriendRequestByName(uint(ownerId), targetName, greeting)
+	}
 	if err != nil {
 		zap.S().Info(err.Error())
 		common.SendErrorResp(ctx.Writer, http.StatusInternalServerError, err.Error(), nil)
 		return
 	}
 
-	common.SendNormalResp(ctx.Writer, "Success to Add Friend", nil, nil, 0)
+	common.SendNormalResp(ctx.Writer, msg, nil, nil, 0)
 }
 
 // UpdateRelation update relation desc
@@ -111,7 +165,28 @@ func UpdateRelation(ctx *gin.Context) {
 			common.SendErrorResp(ctx.Writer, http.StatusBadRequest, errMsg, nil)
 			return
 		}
-		if err = dao.UpdateFriendRelation(uint(ownerId), targetName, r); err != nil {
+		// the private data of friend, the param sent with empty value clears the field
+		update := dao.FriendUpdate{}
+		if v, ok := ctx.GetPostForm("desc"); ok {
+			update.Desc = &v
+		}
+		if v, ok := ctx.GetPostForm("alias"); ok {
+			update.Alias = &v
+		}
+		if v, ok := ctx.GetPostForm("category_id"); ok {
+			categoryId, err := strconv.Atoi(v)
+			if err != nil || categoryId < 0 {
+				common.SendErrorResp(ctx.Writer, http.StatusBadRequest, "Failed to Get category_id", nil)
+				return
+			}
+			id := uint(categoryId)
+			update.CategoryId = &id
+		}
+		if v, ok := ctx.GetPostForm("tags"); ok {
+			tags := strings.Split(v, ",")
+			update.Tags = &tags
+		}
+		if err = dao.UpdateFriendRelation(uint(ownerId), targetName, update); err != nil {
 			zap.S().Info(err.Error())
 			common.SendErrorResp(ctx.Writer, http.StatusInternalServerError, err.Error(), nil)
 			return
@@ -222,9 +297,10 @@ func CreateGroup(ctx *gin.Context) {
 }
 
 // SearchGroup return group list that has target name or gid
+/* searching by name only returns a page of public groups and the groups user has joined in, see dao.SearchGroupDirectory for more */
 func SearchGroup(ctx *gin.Context) {
-	groupName := ctx.PostForm("group_name")
-	gid := ctx.PostForm("group_id")
+	groupName := ctx.Query("group_name")
+	gid := ctx.Query("group_id")
 
 	if gid != "" {
 		community, err := dao.FindGroupByGid(gid)
@@ -235,7 +311,15 @@ func SearchGroup(ctx *gin.Context) {
 		}
 		common.SendNormalResp(ctx.Writer, "Successfully find group!", nil, community, 1)
 	} else if groupName != "" {
-		communities, err := dao.FindGroupByName(groupName)
+		userId, err := strconv.Atoi(ctx.Query("userId"))
+		if err != nil {
+			zap.S().Info(err.Error())
+			errMsg := "Failed to Get UserId"
+			common.SendErrorResp(ctx.Writer, http.StatusInternalServerError, errMsg, nil)
+			return
+		}
+		page, size := getQueryPageParams(ctx)
+		communities, err := dao.FindGroupByName(uint(userId), groupName, page, size)
 		if err != nil {
 			zap.S().Info(err.Error())
 			common.SendErrorResp(ctx.Writer, http.StatusInternalServerError, err.Error(), nil)
@@ -266,14 +350,14 @@ func JoinGroup(ctx *gin.Context) {
 		common.SendErrorResp(ctx.Writer, http.StatusInternalServerError, errMsg, nil)
 		return
 	}
-	// Join in group
-	err = dao.JoinInCommunityByGId(uint(ownerId), gid)
+	// Join in group, or send a join request if the group requires approval
+	msg, err := dao.JoinInCommunityByGId(uint(ownerId), gid, ctx.PostForm("greeting"))
 	if err != nil {
 		zap.S().Info(err.Error())
 		common.SendErrorResp(ctx.Writer, http.StatusInternalServerError, err.Error(), nil)
 		return
 	}
-	common.SendNormalResp(ctx.Writer, "Successfully join group!", nil, nil, 0)
+	common.SendNormalResp(ctx.Writer, msg, nil, nil, 0)
 }
 
 // UpdateGroup Update group information
@@ -319,26 +403,49 @@ func UpdateGroup(ctx *gin.Context) {
 	image := ctx.PostForm("image")
 	desc := ctx.PostForm("desc")
 
-	// create community record
-	community := models.Community{
-		Name:    name,
-		OwnerId: uint(newOwnerId),
-		GroupId: gid,
-		Type:    tp,
-		Image:   image,
-		Desc:    desc,
+	// the transfer is checked before updating, so a failed update never leaves a pending transfer, and the
+	// ownership is transferred only after the new owner accepts
+	if newOwnerId != 0 {
+		if _, err = dao.CheckOwnershipTransfer(uint(ownerId), gid, uint(newOwnerId)); err != nil {
+			zap.S().Info(err.Error())
+			common.SendErrorResp(ctx.Writer, http.StatusInternalServerError, err.Error(), nil)
+			return
+		}
 	}
 
-	curCommunity, err := dao.UpdateCommunityInformation(uint(ownerId), community)
-	if err != nil {
-		zap.S().Info(err.Error())
-		common.SendErrorResp(ctx.Writer, http.StatusInternalServerError, err.Error(), nil)
-		return
+	var curCommunity *models.Community
+	if newOwnerId == 0 || name != "" || image != "" || desc != "" || tp != 0 {
+		// create community record
+		community := models.Community{
+			Name:    name,
+			GroupId: gid,
+			Type:    tp,
+			Image:   image,
+			Desc:    desc,
+		}
+		if curCommunity, err = dao.UpdateCommunityInformation(uint(ownerId), community); err != nil {
+			zap.S().Info(err.Error())
+			common.SendErrorResp(ctx.Writer, http.StatusInternalServerError, err.Error(), nil)
+			return
+		}
+	}
+
+	if newOwnerId != 0 {
+		if _, err = dao.CreateOwnershipTransfer(uint(ownerId), gid, uint(newOwnerId)); err != nil {
+			zap.S().Info(err.Error())
+			common.SendErrorResp(ctx.Writer, http.StatusInternalServerError, err.Error(), nil)
+			return
+		}
+		if curCommunity == nil {
+			common.SendNormalResp(ctx.Writer, "Ownership transfer is waiting for acceptance", nil, nil, 0)
+			return
+		}
 	}
 	common.SendNormalResp(ctx.Writer, "Successfully Update group!", nil, curCommunity, 1)
 }
 
 // DelGroup Delete or Quit group by userID and gid
+/* the history of deleted group is archived by default, or purged if history is "purge" */
 func DelGroup(ctx *gin.Context) {
 	// try to get Owner userId
 	ownerId, err := strconv.Atoi(ctx.Query("userId"))
@@ -356,11 +463,327 @@ func DelGroup(ctx *gin.Context) {
 		common.SendErrorResp(ctx.Writer, http.StatusBadRequest, errMsg, nil)
 		return
 	}
-	msg, err := dao.DelGroup(uint(ownerId), gid)
+	policy := models.HistoryArchive
+	switch ctx.PostForm("history") {
+	case "", "archive":
+	case "purge":
+		policy = models.HistoryPurge
+	default:
+		errMsg := "history should be archive or purge"
+		common.SendErrorResp(ctx.Writer, http.StatusBadRequest, errMsg, nil)
+		return
+	}
+	msg, err := dao.DelGroup(uint(ownerId), gid, policy)
+	if err != nil {
+		zap.S().Info(err.Error())
+		common.SendErrorResp(ctx.Writer, http.StatusInternalServerError, err.Error(), nil)
+		return
+	}
+	common.SendNormalResp(ctx.Writer, msg, nil, nil, 0)
+}
+
+// DeletedGroupList return the deleted groups of user which can still be restored
+func DeletedGroupList(ctx *gin.Context) {
+	ownerId, err := strconv.Atoi(ctx.Query("userId"))
+	if err != nil {
+		zap.S().Info(err.Error())
+		errMsg := "Failed to Get OwnerId"
+		common.SendErrorResp(ctx.Writer, http.StatusInternalServerError, errMsg, nil)
+		return
+	}
+	deletions, err := dao.GetDeletedGroups(uint(ownerId))
+	if err != nil {
+		zap.S().Info(err.Error())
+		common.SendErrorResp(ctx.Writer, http.StatusInternalServerError, err.Error(), nil)
+		return
+	}
+	common.SendNormalResp(ctx.Writer, "Successfully find deleted groups!", nil, *deletions, len(*deletions))
+}
+
+// RestoreGroup restore the deleted group by owner in grace period
+func RestoreGroup(ctx *gin.Context) {
+	ownerId, err := strconv.Atoi(ctx.Query("userId"))
+	if err != nil {
+		zap.S().Info(err.Error())
+		errMsg := "Failed to Get OwnerId"
+		common.SendErrorResp(ctx.Writer, http.StatusInternalServerError, errMsg, nil)
+		return
+	}
+	gid := ctx.PostForm("group_id")
+	if gid == "" {
+		zap.S().Info("Don't have necessary params")
+		errMsg := "please add necessary params: group_id"
+		common.SendErrorResp(ctx.Writer, http.StatusBadRequest, errMsg, nil)
+		return
+	}
+	group, err := dao.RestoreGroup(uint(ownerId), gid)
 	if err != nil {
 		zap.S().Info(err.Error())
 		common.SendErrorResp(ctx.Writer, http.StatusInternalServerError, err.Error(), nil)
 		return
 	}
+	common.SendNormalResp(ctx.Writer, "Successfully restore the group!", nil, group, 1)
+}
+
+// PromoteMember make a group member become admin
+func PromoteMember(ctx *gin.Context) {
+	setMemberRole(ctx, models.RoleAdmin, "Successfully promote member!")
+}
+
+// DemoteMember make a group admin become normal member
+func DemoteMember(ctx *gin.Context) {
+	setMemberRole(ctx, models.RoleMember, "Successfully demote member!")
+}
+
+func setMemberRole(ctx *gin.Context, role int, msg string) {
+	ownerId, gid, targetId, ok := getMemberParams(ctx)
+	if !ok {
+		return
+	}
+	if err := dao.SetMemberRole(ownerId, gid, targetId, role); err != nil {
+		zap.S().Info(err.Error())
+		common.SendErrorResp(ctx.Writer, http.StatusInternalServerError, err.Error(), nil)
+		return
+	}
 	common.SendNormalResp(ctx.Writer, msg, nil, nil, 0)
 }
+
+// getMemberParams get the operator userId, group_id and target_id for managing group member, and send error if failed
+func getMemberParams(ctx *gin.Context) (uint, string, uint, bool) {
+	// try to get Owner userId
+	ownerId, err := strconv.Atoi(ctx.Query("userId"))
+	if err != nil {
+		zap.S().Info(err.Error())
+		errMsg := "Failed to Get OwnerId"
+		common.SendErrorResp(ctx.Writer, http.StatusInternalServerError, errMsg, nil)
+		return 0, "", 0, false
+	}
+	// try to get gid and target userId
+	gid := ctx.PostForm("group_id")
+	targetId, err := strconv.Atoi(ctx.PostForm("target_id"))
+	if gid == "" || err != nil {
+		zap.S().Info("Don't have necessary params")
+		errMsg := "please add necessary params: group_id, target_id"
+		common.SendErrorResp(ctx.Writer, http.StatusBadRequest, errMsg, nil)
+		return 0, "", 0, false
+	}
+	return uint(ownerId), gid, uint(targetId), true
+}
+
+// getPageParams get page (start from 1) and size of pagination, size is limited in [1, 100] and default 20
+func getPageParams(ctx *gin.Context) (int, int) {
+	return parsePageParams(ctx.PostForm("page"), ctx.PostForm("size"))
+}
+
+// getQueryPageParams is getPageParams for GET routes, which read page and size from query
+func getQueryPageParams(ctx *gin.Context) (int, int) {
+	return parsePageParams(ctx.Query("page"), ctx.Query("size"))
+}
+
+func parsePageParams(pageStr string, sizeStr string) (int, int) {
+	page, err := strconv.Atoi(pageStr)
+	if err != nil || page < 1 {
+		page = 1
+	}
+	size, err := strconv.Atoi(sizeStr)
+	if err != nil || size < 1 {
+		size = 20
+	}
+	if size > 100 {
+		size = 100
+	}
+	return page, size
+}
+
+// a data model that define the group member information return to User
+type member struct {
+	ID         uint
+	Name       string
+	Avatar     string
+	Role       int
+	Online     bool
+	MutedUntil *time.Time
+}
+
+// MemberList return a page of group members with their roles and presence
+func MemberList(ctx *gin.Context) {
+	// try to get owner userId and gid
+	ownerId, err := strconv.Atoi(ctx.Query("userId"))
+	if err != nil {
+		zap.S().Info(err.Error())
+		errMsg := "Failed to Get OwnerId"
+		common.SendErrorResp(ctx.Writer, http.StatusInternalServerError, errMsg, nil)
+		return
+	}
+	gid := ctx.PostForm("group_id")
+	if gid == "" {
+		zap.S().Info("Don't have necessary params")
+		errMsg := "please add necessary params: group_id"
+		common.SendErrorResp(ctx.Writer, http.StatusBadRequest, errMsg, nil)
+		return
+	}
+	page, size := getPageParams(ctx)
+
+	relations, group, total, err := dao.GetMemberList(uint(ownerId), gid, page, size)
+	if err != nil {
+		zap.S().Info(err.Error())
+		common.SendErrorResp(ctx.Writer, http.StatusInternalServerError, err.Error(), nil)
+		return
+	}
+	membersId := make([]uint, 0)
+	for _, r := range *relations {
+		membersId = append(membersId, r.OwnerId)
+	}
+	users, err := dao.GetUsersByIds(membersId)
+	if err != nil {
+		zap.S().Info(err.Error())
+		common.SendErrorResp(ctx.Writer, http.StatusInternalServerError, err.Error(), nil)
+		return
+	}
+	usersMap := make(map[uint]*models.UserBasic)
+	for _, u := range users {
+		usersMap[u.ID] = u
+	}
+
+	// the presence and avatar are hidden by the privacy settings, and between the users who blocked each other
+	view := models.NewPrivacyView(uint(ownerId), membersId)
+	members := make([]member, 0)
+	for _, r := range *relations {
+		m := member{ID: r.OwnerId, Role: r.Role, MutedUntil: r.MutedUntil}
+		if r.OwnerId == group.OwnerId {
+			m.Role = models.RoleOwner
+		}
+		if u, ok := usersMap[r.OwnerId]; ok {
+			m.Name = u.Name
+			m.Avatar = view.Hide(*u).Avatar
+			m.Online, _ = view.Presence(u)
+		}
+		members = append(members, m)
+	}
+
+	data := make(map[string]string)
+	data["total"] = strconv.FormatInt(total, 10)
+	data["page"] = strconv.Itoa(page)
+	common.SendNormalResp(ctx.Writer, "Successfully find members!", data, members, len(members))
+}
+
+// KickMember remove a member from group
+func KickMember(ctx *gin.Context) {
+	ownerId, gid, targetId, ok := getMemberParams(ctx)
+	if !ok {
+		return
+	}
+	if err := dao.KickMember(ownerId, gid, targetId, false); err != nil {
+		zap.S().Info(err.Error())
+		common.SendErrorResp(ctx.Writer, http.StatusInternalServerError, err.Error(), nil)
+		return
+	}
+	common.SendNormalResp(ctx.Writer, "Successfully kick member!", nil, nil, 0)
+}
+
+// BanMember remove a member from group and forbid him to join in again
+func BanMember(ctx *gin.Context) {
+	ownerId, gid, targetId, ok := getMemberParams(ctx)
+	if !ok {
+		return
+	}
+	if err := dao.KickMember(ownerId, gid, targetId, true); err != nil {
+		zap.S().Info(err.Error())
+		common.SendErrorResp(ctx.Writer, http.StatusInternalServerError, err.Error(), nil)
+		return
+	}
+	common.SendNormalResp(ctx.Writer, "Successfully ban member!", nil, nil, 0)
+}
+
+// UnbanMember allow the banned user to join in group again
+func UnbanMember(ctx *gin.Context) {
+	ownerId, gid, targetId, ok := getMemberParams(ctx)
+	if !ok {
+		return
+	}
+	if err := dao.UnbanMember(ownerId, gid, targetId); err != nil {
+		zap.S().Info(err.Error())
+		common.SendErrorResp(ctx.Writer, http.StatusInternalServerError, err.Error(), nil)
+		return
+	}
+	common.SendNormalResp(ctx.Writer, "Successfully unban user!", nil, nil, 0)
+}
+
+// MuteMember forbid a member posting in group for duration seconds, 0 means unmute
+func MuteMember(ctx *gin.Context) {
+	ownerId, gid, targetId, ok := getMemberParams(ctx)
+	if !ok {
+		return
+	}
+	duration, err := strconv.Atoi(ctx.PostForm("duration"))
+	if err != nil || duration < 0 {
+		zap.S().Info("Invalid duration")
+		errMsg := "please add necessary params: duration(seconds, 0 means unmute)"
+		common.SendErrorResp(ctx.Writer, http.StatusBadRequest, errMsg, nil)
+		return
+	}
+	if err = dao.MuteMember(ownerId, gid, targetId, time.Duration(duration)*time.Second); err != nil {
+		zap.S().Info(err.Error())
+		common.SendErrorResp(ctx.Writer, http.StatusInternalServerError, err.Error(), nil)
+		return
+	}
+	common.SendNormalResp(ctx.Writer, "Successfully mute member!", nil, nil, 0)
+}
+
+// GroupDirectory search the public groups by name, type, and return a page sorted by members, activity or newest
+func GroupDirectory(ctx *gin.Context) {
+	q := dao.DirectoryQuery{
+		Keyword: ctx.Query("keyword"),
+		Fuzzy:   ctx.Query("match") == "fuzzy",
+		Sort:    ctx.Query("sort"),
+		Cursor:  ctx.Query("cursor"),
+		Size:    20,
+	}
+	if typeStr := ctx.Query("type"); typeStr != "" {
+		tp, err := strconv.Atoi(typeStr)
+		if err != nil {
+			zap.S().Info(err.Error())
+			common.SendErrorResp(ctx.Writer, http.StatusBadRequest, "Failed to Get type", nil)
+			return
+		}
+		q.Type = &tp
+	}
+	if size, err := strconv.Atoi(ctx.Query("size")); err == nil && size > 0 && size <= 100 {
+		q.Size = size
+	}
+
+	entries, next, err := dao.SearchGroupDirectory(q)
+	if err != nil {
+		zap.S().Info(err.Error())
+		common.SendErrorResp(ctx.Writer, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+	data := make(map[string]string)
+	data["cursor"] = next
+	common.SendNormalResp(ctx.Writer, "Successfully find group!", data, entries, len(entries))
+}
+
+// SetGroupVisibility list or unlist the group in public group directory
+func SetGroupVisibility(ctx *gin.Context) {
+	ownerId, err := strconv.Atoi(ctx.Query("userId"))
+	if err != nil {
+		zap.S().Info(err.Error())
+		errMsg := "Failed to Get OwnerId"
+		common.SendErrorResp(ctx.Writer, http.StatusInternalServerError, errMsg, nil)
+		return
+	}
+	gid := ctx.PostForm("group_id")
+	isPublic, err := strconv.ParseBool(ctx.PostForm("is_public"))
+	if gid == "" || err != nil {
+		zap.S().Info("Don't have necessary params")
+		errMsg := "please add necessary params: group_id, is_public"
+		common.SendErrorResp(ctx.Writer, http.StatusBadRequest, errMsg, nil)
+		return
+	}
+	if err = dao.SetGroupVisibility(uint(ownerId), gid, isPublic); err != nil {
+		zap.S().Info(err.Error())
+		common.SendErrorResp(ctx.Writer, http.StatusInternalServerError, err.Error(), nil)
+		return
+	}
+	common.SendNormalResp(ctx.Writer, "Successfully update visibility!", nil, nil, 0)
+}
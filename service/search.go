@@ -0,0 +1,94 @@
+package service
+
+import (
+	"HiChat/common"
+	"HiChat/dao"
+	"HiChat/models"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"net/http"
+	"strconv"
+)
+
+// SearchUser find users by name prefix, or by exact user-visible id, phone or email
+/* the users are hidden by their privacy settings, and the phone and email are never returned */
+func SearchUser(ctx *gin.Context) {
+	userId, err := strconv.Atoi(ctx.Query("userId"))
+	if err != nil {
+		zap.S().Info(err.Error())
+		errMsg := "Failed to Get UserId"
+		common.SendErrorResp(ctx.Writer, http.StatusInternalServerError, errMsg, nil)
+		return
+	}
+	keyword := ctx.Query("keyword")
+	if keyword == "" {
+		zap.S().Info("Don't have necessary params")
+		errMsg := "please add necessary params: keyword"
+		common.SendErrorResp(ctx.Writer, http.StatusBadRequest, errMsg, nil)
+		return
+	}
+
+	var users []*models.UserBasic
+	switch by := ctx.DefaultQuery("by", "name"); by {
+	case "name":
+		users, err = dao.SearchUsersByName(uint(userId), keyword)
+	default:
+		var u *models.UserBasic
+		if u, err = dao.FindUserByContact(uint(userId), by, keyword); err == nil {
+			users = []*models.UserBasic{u}
+		}
+	}
+	if err != nil {
+		zap.S().Info(err.Error())
+		common.SendErrorResp(ctx.Writer, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	usersId := make([]uint, 0, len(users))
+	for _, u := range users {
+		usersId = append(usersId, u.ID)
+	}
+	view := models.NewPrivacyView(uint(userId), usersId)
+	result := make([]user, 0, len(users))
+	for _, u := range users {
+		result = append(result, user{ID: u.ID, PublicId: u.PublicId, Name: u.Name, Avatar: view.Hide(*u).Avatar, Gender: u.Gender})
+	}
+	common.SendNormalResp(ctx.Writer, "Success to Search User", nil, result, len(result))
+}
+
+// UpdatePrivacySetting update the privacy setting of user, and return the current setting
+/*
+every setting is one of 0(everyone), 1(friends) and 2(nobody), except friend_request which is one of
+0(everyone), 1(users with mutual friends or shared groups) and 2(nobody), the setting not sent is not changed
+*/
+func UpdatePrivacySetting(ctx *gin.Context) {
+	userId, err := strconv.Atoi(ctx.Query("userId"))
+	if err != nil {
+		zap.S().Info(err.Error())
+		errMsg := "Failed to Get UserId"
+		common.SendErrorResp(ctx.Writer, http.StatusInternalServerError, errMsg, nil)
+		return
+	}
+	updates := make(map[string]interface{})
+	for _, column := range []string{
+		"find_by_name", "find_by_phone", "find_by_email", "friend_request",
+		"online_status", "add_to_group", "show_avatar", "show_phone", "show_email",
+	} {
+		if str, ok := ctx.GetPostForm(column); ok {
+			v, err := strconv.Atoi(str)
+			if err != nil {
+				zap.S().Info(err.Error())
+				common.SendErrorResp(ctx.Writer, http.StatusBadRequest, "Failed to Get "+column, nil)
+				return
+			}
+			updates[column] = v
+		}
+	}
+	setting, err := dao.UpdatePrivacySetting(uint(userId), updates)
+	if err != nil {
+		zap.S().Info(err.Error())
+		common.SendErrorResp(ctx.Writer, http.StatusInternalServerError, err.Error(), nil)
+		return
+	}
+	common.SendNormalResp(ctx.Writer, "Success to Update Privacy Setting", nil, setting, 1)
+}
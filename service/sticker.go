@@ -0,0 +1,205 @@
+package service
+
+import (
+	"HiChat/common"
+	"HiChat/dao"
+	"HiChat/models"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// the file types that can be uploaded as sticker
+var stickerSuffixes = map[string]bool{".png": true, ".jpg": true, ".jpeg": true, ".gif": true, ".webp": true}
+
+// a data model that define the Sticker Pack information return to User
+type stickerPack struct {
+	ID          uint
+	Name        string
+	OwnerId     uint
+	CommunityId uint
+	Cover       string
+	Desc        string
+	Items       []models.StickerItem
+}
+
+// CreateStickerPack create a user sticker pack, or a group-scoped pack if group_id is given
+func CreateStickerPack(ctx *gin.Context) {
+	ownerId, err := strconv.Atoi(ctx.Query("userId"))
+	if err != nil {
+		zap.S().Info(err.Error())
+		errMsg := "Failed to Get OwnerId"
+		common.SendErrorResp(ctx.Writer, http.StatusInternalServerError, errMsg, nil)
+		return
+	}
+	name := ctx.PostForm("name")
+	if name == "" {
+		zap.S().Info("Don't have necessary params")
+		errMsg := "please add necessary params: name"
+		common.SendErrorResp(ctx.Writer, http.StatusBadRequest, errMsg, nil)
+		return
+	}
+
+	pack := models.StickerPack{
+		Name:    name,
+		OwnerId: uint(ownerId),
+		Desc:    ctx.PostForm("desc"),
+	}
+	newPack, err := dao.CreateStickerPack(pack, ctx.PostForm("group_id"))
+	if err != nil {
+		zap.S().Info(err.Error())
+		common.SendErrorResp(ctx.Writer, http.StatusInternalServerError, err.Error(), nil)
+		return
+	}
+	common.SendNormalResp(ctx.Writer, "Successfully Create sticker pack!", nil, newPack, 1)
+}
+
+// UploadSticker upload an image file into sticker pack
+func UploadSticker(ctx *gin.Context) {
+	ownerId, err := strconv.Atoi(ctx.Query("userId"))
+	if err != nil {
+		zap.S().Info(err.Error())
+		errMsg := "Failed to Get OwnerId"
+		common.SendErrorResp(ctx.Writer, http.StatusInternalServerError, errMsg, nil)
+		return
+	}
+	packId, err := strconv.Atoi(ctx.PostForm("pack_id"))
+	if err != nil {
+		zap.S().Info(err.Error())
+		errMsg := "please add necessary params: pack_id"
+		common.SendErrorResp(ctx.Writer, http.StatusBadRequest, errMsg, nil)
+		return
+	}
+
+	// only image can be used as sticker
+	_, head, err := ctx.Request.FormFile("file")
+	if err != nil || !stickerSuffixes[strings.ToLower(path.Ext(head.Filename))] {
+		zap.S().Info("Invalid sticker file")
+		errMsg := "sticker should be png, jpg, gif or webp file"
+		common.SendErrorResp(ctx.Writer, http.StatusBadRequest, errMsg, nil)
+		return
+	}
+	// the file is saved only after the pack owner is checked
+	if _, err = dao.CheckStickerPackOwner(uint(ownerId), uint(packId)); err != nil {
+		zap.S().Info(err.Error())
+		common.SendErrorResp(ctx.Writer, http.StatusForbidden, err.Error(), nil)
+		return
+	}
+	url, err := saveUploadFile(ctx.Request)
+	if err != nil {
+		zap.S().Info(err.Error())
+		common.SendErrorResp(ctx.Writer, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	name := ctx.PostForm("name")
+	if name == "" {
+		name = strings.TrimSuffix(head.Filename, path.Ext(head.Filename))
+	}
+	item := models.StickerItem{
+		PackId: uint(packId),
+		Name:   name,
+		Url:    url,
+	}
+	newItem, err := dao.AddStickerItem(uint(ownerId), item)
+	if err != nil {
+		zap.S().Info(err.Error())
+		common.SendErrorResp(ctx.Writer, http.StatusInternalServerError, err.Error(), nil)
+		return
+	}
+	common.SendNormalResp(ctx.Writer, "Successfully Upload sticker!", nil, newItem, 1)
+}
+
+// StickerPackList return the sticker packs and their stickers which user has installed
+func StickerPackList(ctx *gin.Context) {
+	ownerId, err := strconv.Atoi(ctx.Query("userId"))
+	if err != nil {
+		zap.S().Info(err.Error())
+		errMsg := "Failed to Get OwnerId"
+		common.SendErrorResp(ctx.Writer, http.StatusInternalServerError, errMsg, nil)
+		return
+	}
+	packs, err := dao.GetInstalledPacks(uint(ownerId))
+	if err != nil {
+		zap.S().Info(err.Error())
+		common.SendErrorResp(ctx.Writer, http.StatusInternalServerError, err.Error(), nil)
+		return
+	}
+	if packs == nil {
+		zap.S().Info("User didn't install any sticker pack")
+		common.SendNormalResp(ctx.Writer, "User didn't install any sticker pack", nil, nil, 0)
+		return
+	}
+
+	res := make([]stickerPack, 0)
+	for _, p := range *packs {
+		items, err := dao.GetStickerItems(p.ID)
+		if err != nil {
+			zap.S().Info(err.Error())
+			common.SendErrorResp(ctx.Writer, http.StatusInternalServerError, err.Error(), nil)
+			return
+		}
+		res = append(res, stickerPack{
+			ID:          p.ID,
+			Name:        p.Name,
+			OwnerId:     p.OwnerId,
+			CommunityId: p.CommunityId,
+			Cover:       p.Cover,
+			Desc:        p.Desc,
+			Items:       *items,
+		})
+	}
+	common.SendNormalResp(ctx.Writer, "Successfully find sticker packs!", nil, res, len(res))
+}
+
+// InstallStickerPack install sticker pack by pack id
+func InstallStickerPack(ctx *gin.Context) {
+	ownerId, err := strconv.Atoi(ctx.Query("userId"))
+	if err != nil {
+		zap.S().Info(err.Error())
+		errMsg := "Failed to Get OwnerId"
+		common.SendErrorResp(ctx.Writer, http.StatusInternalServerError, errMsg, nil)
+		return
+	}
+	packId, err := strconv.Atoi(ctx.PostForm("pack_id"))
+	if err != nil {
+		zap.S().Info(err.Error())
+		errMsg := "please add necessary params: pack_id"
+		common.SendErrorResp(ctx.Writer, http.StatusBadRequest, errMsg, nil)
+		return
+	}
+	if err = dao.InstallStickerPack(uint(ownerId), uint(packId)); err != nil {
+		zap.S().Info(err.Error())
+		common.SendErrorResp(ctx.Writer, http.StatusInternalServerError, err.Error(), nil)
+		return
+	}
+	common.SendNormalResp(ctx.Writer, "Successfully install sticker pack!", nil, nil, 0)
+}
+
+// RemoveStickerPack Delete or uninstall sticker pack by pack id
+func RemoveStickerPack(ctx *gin.Context) {
+	ownerId, err := strconv.Atoi(ctx.Query("userId"))
+	if err != nil {
+		zap.S().Info(err.Error())
+		errMsg := "Failed to Get OwnerId"
+		common.SendErrorResp(ctx.Writer, http.StatusInternalServerError, errMsg, nil)
+		return
+	}
+	packId, err := strconv.Atoi(ctx.PostForm("pack_id"))
+	if err != nil {
+		zap.S().Info(err.Error())
+		errMsg := "please add necessary params: pack_id"
+		common.SendErrorResp(ctx.Writer, http.StatusBadRequest, errMsg, nil)
+		return
+	}
+	msg, err := dao.RemoveStickerPack(uint(ownerId), uint(packId))
+	if err != nil {
+		zap.S().Info(err.Error())
+		common.SendErrorResp(ctx.Writer, http.StatusInternalServerError, err.Error(), nil)
+		return
+	}
+	common.SendNormalResp(ctx.Writer, msg, nil, nil, 0)
+}
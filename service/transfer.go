@@ -0,0 +1,110 @@
+package service
+
+import (
+	"HiChat/common"
+	"HiChat/dao"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"net/http"
+	"strconv"
+)
+
+// TransferOwnership start transferring the group ownership to a member, which takes effect after the member accepts
+func TransferOwnership(ctx *gin.Context) {
+	ownerId, gid, targetId, ok := getMemberParams(ctx)
+	if !ok {
+		return
+	}
+	transfer, err := dao.CreateOwnershipTransfer(ownerId, gid, targetId)
+	if err != nil {
+		zap.S().Info(err.Error())
+		common.SendErrorResp(ctx.Writer, http.StatusInternalServerError, err.Error(), nil)
+		return
+	}
+	common.SendNormalResp(ctx.Writer, "Ownership transfer is waiting for acceptance", nil, transfer, 1)
+}
+
+// TransferList return the ownership transfers waiting for user's acceptance
+func TransferList(ctx *gin.Context) {
+	ownerId, err := strconv.Atoi(ctx.Query("userId"))
+	if err != nil {
+		zap.S().Info(err.Error())
+		errMsg := "Failed to Get OwnerId"
+		common.SendErrorResp(ctx.Writer, http.StatusInternalServerError, errMsg, nil)
+		return
+	}
+	transfers, err := dao.GetPendingTransfers(uint(ownerId))
+	if err != nil {
+		zap.S().Info(err.Error())
+		common.SendErrorResp(ctx.Writer, http.StatusInternalServerError, err.Error(), nil)
+		return
+	}
+	common.SendNormalResp(ctx.Writer, "Successfully find transfers!", nil, *transfers, len(*transfers))
+}
+
+// AcceptTransfer accept the ownership transfer and become the group owner
+func AcceptTransfer(ctx *gin.Context) {
+	handleTransfer(ctx, dao.RespondOwnershipTransfer, true, "Successfully accept transfer!")
+}
+
+// DeclineTransfer decline the ownership transfer
+func DeclineTransfer(ctx *gin.Context) {
+	handleTransfer(ctx, dao.RespondOwnershipTransfer, false, "Successfully decline transfer!")
+}
+
+// CancelTransfer cancel the ownership transfer by the owner
+func CancelTransfer(ctx *gin.Context) {
+	cancel := func(userId uint, transferId uint, _ bool) error {
+		return dao.CancelOwnershipTransfer(userId, transferId)
+	}
+	handleTransfer(ctx, cancel, false, "Successfully cancel transfer!")
+}
+
+func handleTransfer(ctx *gin.Context, handle func(uint, uint, bool) error, accept bool, msg string) {
+	ownerId, err := strconv.Atoi(ctx.Query("userId"))
+	if err != nil {
+		zap.S().Info(err.Error())
+		errMsg := "Failed to Get OwnerId"
+		common.SendErrorResp(ctx.Writer, http.StatusInternalServerError, errMsg, nil)
+		return
+	}
+	transferId, err := strconv.Atoi(ctx.PostForm("transfer_id"))
+	if err != nil {
+		zap.S().Info("Don't have necessary params")
+		errMsg := "please add necessary params: transfer_id"
+		common.SendErrorResp(ctx.Writer, http.StatusBadRequest, errMsg, nil)
+		return
+	}
+	if err = handle(uint(ownerId), uint(transferId), accept); err != nil {
+		zap.S().Info(err.Error())
+		common.SendErrorResp(ctx.Writer, http.StatusInternalServerError, err.Error(), nil)
+		return
+	}
+	common.SendNormalResp(ctx.Writer, msg, nil, nil, 0)
+}
+
+// AuditLogList return a page of the audit logs of group
+func AuditLogList(ctx *gin.Context) {
+	ownerId, err := strconv.Atoi(ctx.Query("userId"))
+	if err != nil {
+		zap.S().Info(err.Error())
+		errMsg := "Failed to Get OwnerId"
+		common.SendErrorResp(ctx.Writer, http.StatusInternalServerError, errMsg, nil)
+		return
+	}
+	gid := ctx.PostForm("group_id")
+	if gid == "" {
+		zap.S().Info("Don't have necessary params")
+		errMsg := "please add necessary params: group_id"
+		common.SendErrorResp(ctx.Writer, http.StatusBadRequest, errMsg, nil)
+		return
+	}
+	page, size := getPageParams(ctx)
+	logs, err := dao.GetAuditLogs(uint(ownerId), gid, page, size)
+	if err != nil {
+		zap.S().Info(err.Error())
+		common.SendErrorResp(ctx.Writer, http.StatusInternalServerError, err.Error(), nil)
+		return
+	}
+	common.SendNormalResp(ctx.Writer, "Successfully find audit logs!", nil, *logs, len(*logs))
+}
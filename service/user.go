@@ -15,8 +15,23 @@ import (
 	"time"
 )
 
+// userStatus is a user with the presence seen by the viewer
+type userStatus struct {
+	user
+	Online   bool
+	LastSeen *time.Time
+}
+
 // UserList Get Method, Provided for Admin
+/* the avatar, phone, email and presence are hidden by the privacy settings of users */
 func UserList(ctx *gin.Context) {
+	userId, err := strconv.Atoi(ctx.Query("userId"))
+	if err != nil {
+		zap.S().Info(err.Error())
+		errMsg := "Failed to Get UserId"
+		common.SendErrorResp(ctx.Writer, http.StatusInternalServerError, errMsg, nil)
+		return
+	}
 	list, err := dao.GetUserList()
 	if err != nil {
 		zap.S().Info("DB GetUserList Failed")
@@ -24,7 +39,19 @@ func UserList(ctx *gin.Context) {
 		common.SendErrorResp(ctx.Writer, http.StatusInternalServerError, errMsg, nil)
 		return
 	}
-	common.SendNormalResp(ctx.Writer, "Success to Get User List", nil, list, len(list))
+
+	usersId := make([]uint, 0, len(list))
+	for _, u := range list {
+		usersId = append(usersId, u.ID)
+	}
+	view := models.NewPrivacyView(uint(userId), usersId)
+	users := make([]userStatus, 0, len(list))
+	for _, u := range list {
+		s := userStatus{user: newUser(view.Hide(*u))}
+		s.Online, s.LastSeen = view.Presence(u)
+		users = append(users, s)
+	}
+	common.SendNormalResp(ctx.Writer, "Success to Get User List", nil, users, len(users))
 }
 
 // UserLoginByNameAndPwd Post method
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"HiChat/common"
 	"HiChat/global"
 	"HiChat/initialize"
 	"HiChat/models"
@@ -29,24 +30,91 @@ func CreateTables(db *gorm.DB) {
 	createUserTable(db)
 	createRelationTable(db)
 	createCommunityTable(db)
+	createStickerTable(db)
 }
 
 func createUserTable(db *gorm.DB) {
-	err := db.AutoMigrate(&models.UserBasic{})
+	err := db.AutoMigrate(&models.UserBasic{}, &models.PrivacySetting{}, &models.BroadcastAccount{})
 	if err != nil {
 		panic(err)
 	}
 }
 
 func createRelationTable(db *gorm.DB) {
-	err := db.AutoMigrate(&models.Relation{})
+	err := db.AutoMigrate(&models.Relation{}, &models.FriendRequest{}, &models.ContactCategory{}, &models.FriendTag{},
+		&models.ContactHash{}, &models.ConversationSetting{})
 	if err != nil {
 		panic(err)
 	}
 }
 
 func createCommunityTable(db *gorm.DB) {
-	err := db.AutoMigrate(&models.Community{})
+	err := db.AutoMigrate(&models.Community{}, &models.CommunityBan{}, &models.JoinRequest{}, &models.InviteLink{},
+		&models.OwnershipTransfer{}, &models.GroupAuditLog{}, &models.GroupChannel{},
+		&models.GroupDeletion{})
+	if err != nil {
+		panic(err)
+	}
+}
+
+func createStickerTable(db *gorm.DB) {
+	err := db.AutoMigrate(&models.StickerPack{}, &models.StickerItem{}, &models.StickerInstall{})
+	if err != nil {
+		panic(err)
+	}
+}
+
+// MigratePublicIds assign new user-visible ids to existing groups and users, the legacy group ids are kept for resolving
+func MigratePublicIds(db *gorm.DB) {
+	communities := make([]models.Community, 0)
+	err := db.FindInBatches(&communities, 100, func(tx *gorm.DB, batch int) error {
+		for _, c := range communities {
+			if !common.IsLegacyId(c.GroupId) && c.GroupId != "" {
+				continue
+			}
+			err := tx.Model(&c).UpdateColumns(map[string]interface{}{
+				"legacy_group_id": c.GroupId,
+				"group_id":        common.GenerateId(common.GroupIdPrefix, c.ID),
+			}).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}).Error
+	if err != nil {
+		panic(err)
+	}
+
+	users := make([]models.UserBasic, 0)
+	err = db.Where("public_id = '' or public_id is null").FindInBatches(&users, 100, func(tx *gorm.DB, batch int) error {
+		for _, u := range users {
+			if err := tx.Model(&u).UpdateColumn("public_id", common.GenerateId(common.UserIdPrefix, u.ID)).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	}).Error
+	if err != nil {
+		panic(err)
+	}
+}
+
+// MigrateContactHashes fill in the hashed phones and emails of existing users, which are used in contact matching
+func MigrateContactHashes(db *gorm.DB) {
+	users := make([]models.UserBasic, 0)
+	err := db.Where("(phone <> '' and (phone_hash = '' or phone_hash is null)) or (email <> '' and (email_hash = '' or email_hash is null))").FindInBatches(&users, 100, func(tx *gorm.DB, batch int) error {
+		for _, u := range users {
+			err := tx.Model(&u).UpdateColumns(map[string]interface{}{
+				"phone_hash": common.HashContact(common.NormalizePhone(u.Phone)),
+				"email_hash": common.HashContact(common.NormalizeEmail(u.Email)),
+			}).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}).Error
 	if err != nil {
 		panic(err)
 	}
@@ -9,6 +9,12 @@ func main() {
 	// create tables
 	CreateTables(db)
 
+	// assign new user-visible ids to existing records
+	MigratePublicIds(db)
+
+	// hash the phones and emails of existing users for contact matching
+	MigrateContactHashes(db)
+
 	// 2. Redis Initial
 	/*
 		redisClient := ConnectToRedis()